@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"blog-system/internal/auth"
+	"blog-system/internal/domain"
 	"blog-system/internal/handler"
 	"blog-system/internal/repository"
 	"blog-system/internal/service"
 	"blog-system/pkg/config"
 	"blog-system/pkg/database"
+	"blog-system/pkg/mailer"
 
 	"github.com/gorilla/mux"
 )
@@ -24,31 +33,130 @@ func main() {
 	}
 	defer db.Close()
 
-	sessionManager := auth.NewSessionManager(cfg.SessionSecret)
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], db); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var sessionStore auth.SessionStore = auth.NewSQLiteStore(db)
+	if cfg.SessionStore == "memory" {
+		sessionStore = auth.NewMemoryStore()
+	}
+	sessionManager := auth.NewSessionManager(cfg.SessionSecret, cfg.PreviousSessionSecrets, sessionStore, auth.SessionTimeouts{
+		Idle:     cfg.SessionIdleTimeout,
+		Absolute: cfg.SessionAbsoluteTimeout,
+		Remember: cfg.SessionRememberTimeout,
+	})
+
+	var attemptStore auth.AttemptStore = auth.NewSQLiteAttemptStore(db)
+	if cfg.LoginAttemptStore == "memory" {
+		attemptStore = auth.NewMemoryAttemptStore()
+	}
+	loginLimiter := auth.NewLoginLimiter(attemptStore, auth.DefaultIPPolicy, auth.DefaultAccountPolicy)
 
 	repo := repository.NewSQLiteRepository(db)
-	blogService := service.NewBlogService(repo)
+	auditLogger := service.NewAuditLogger(repo)
+	blogService := service.NewBlogService(repo, auditLogger)
+	if err := blogService.EnsureSlugs(); err != nil {
+		log.Fatal("Failed to generate article slugs:", err)
+	}
+	if err := blogService.EnsureRendered(); err != nil {
+		log.Fatal("Failed to render articles:", err)
+	}
+	userService := service.NewUserService(repo, repo, sessionManager, cfg.TOTPIssuer)
+	if err := userService.EnsureAdmin(cfg.AdminUsername, cfg.AdminPassword); err != nil {
+		log.Fatal("Failed to initialize admin account:", err)
+	}
+
+	tokenService := service.NewTokenService(repo, repo)
+
+	var mail mailer.Mailer = mailer.NewCaptureMailer()
+	if cfg.Mailer == "smtp" {
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+	magicLinkService := service.NewMagicLinkService(repo, repo, sessionManager, mail, cfg.BaseURL)
+	passwordResetService := service.NewPasswordResetService(repo, repo, sessionManager, mail, cfg.BaseURL)
+
 	blogHandler := handler.NewBlogHandler(blogService)
-	authHandler := handler.NewAuthHandler(sessionManager, cfg.AdminPassword)
+	authHandler := handler.NewAuthHandler(sessionManager, userService, loginLimiter, magicLinkService, auditLogger)
+	userHandler := handler.NewUserHandler(userService, sessionManager, loginLimiter, auditLogger)
+	tokenHandler := handler.NewTokenHandler(tokenService, auditLogger)
+	passwordHandler := handler.NewPasswordHandler(userService, passwordResetService, sessionManager, loginLimiter, auditLogger)
+	auditHandler := handler.NewAuditHandler(auditLogger)
 
 	r := mux.NewRouter()
 	api := r.PathPrefix("/api").Subrouter()
 
-	authHandler.RegisterRoutes(api)
-	blogHandler.RegisterRoutes(api, sessionManager)
+	// routes behind protect require a session or API token, and a CSRF token
+	// for state-changing requests made with the session cookie
+	authenticate := auth.AuthMiddleware(sessionManager, userService, tokenService)
+	csrf := auth.CSRFMiddleware(sessionManager)
+	protect := func(next http.Handler) http.Handler {
+		return authenticate(csrf(next))
+	}
+	// public routes that show more to logged in users
+	identify := auth.OptionalAuthMiddleware(sessionManager, userService, tokenService)
+
+	authHandler.RegisterRoutes(api, protect)
+	blogHandler.RegisterRoutes(api, protect, identify)
+	userHandler.RegisterRoutes(api, protect)
+	tokenHandler.RegisterRoutes(api, protect)
+	passwordHandler.RegisterRoutes(api, protect)
+	auditHandler.RegisterRoutes(api, protect)
+	if cfg.OIDCIssuerURL != "" {
+		newOIDCHandler(cfg, repo, userService, sessionManager, auditLogger).RegisterRoutes(api)
+	}
 
 	r.Use(corsMiddleware)
+	r.Use(auth.ClientInfoMiddleware)
+
+	// stop on Ctrl+C or SIGTERM, letting requests and the scheduler finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scheduler := service.NewScheduler(repo, auditLogger, cfg.SchedulerInterval)
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		scheduler.Run(ctx)
+	}()
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Handler: r,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
 
 	fmt.Printf("Blog server starting on :%d\n", cfg.Port)
 	fmt.Printf("Database: %s\n", cfg.DBPath)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), r))
+
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Shutdown:", err)
+	}
+	background.Wait()
+	fmt.Println("Blog server stopped")
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+auth.CSRFHeaderName)
 
 		if (*r).Method == "OPTIONS" {
 			return
@@ -57,3 +165,56 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// runCommand runs an administration command instead of the server:
+//
+//	rebuild-search-index  indexes every article for search again
+func runCommand(name string, db *sql.DB) error {
+	switch name {
+	case "rebuild-search-index":
+		enabled, err := database.HasFTS5(db)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return fmt.Errorf("search needs a server built with -tags sqlite_fts5")
+		}
+
+		indexed, err := database.RebuildSearchIndex(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Indexed %d articles\n", indexed)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// newOIDCHandler sets up single sign-on from the OIDC_* settings.
+func newOIDCHandler(cfg *config.Config, repo *repository.SQLiteRepository, userService *service.UserService, sessionManager *auth.SessionManager, auditLogger *service.AuditLogger) *handler.OIDCHandler {
+	mapping := service.SSORoleMapping{
+		GroupRoles:  make(map[string]domain.Role),
+		DefaultRole: domain.Role(cfg.OIDCDefaultRole),
+	}
+	for group, role := range cfg.OIDCGroupRoles {
+		if !domain.Role(role).Valid() {
+			log.Fatalf("OIDC_GROUP_ROLES: invalid role %q for group %q", role, group)
+		}
+		mapping.GroupRoles[group] = domain.Role(role)
+	}
+	if mapping.DefaultRole != "" && !mapping.DefaultRole.Valid() {
+		log.Fatalf("OIDC_DEFAULT_ROLE: invalid role %q", cfg.OIDCDefaultRole)
+	}
+
+	provider := auth.NewOIDCProvider(auth.OIDCConfig{
+		IssuerURL:    cfg.OIDCIssuerURL,
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		RedirectURL:  cfg.OIDCRedirectURL,
+		Scopes:       cfg.OIDCScopes,
+		GroupsClaim:  cfg.OIDCGroupsClaim,
+	}, nil)
+
+	return handler.NewOIDCHandler(provider, service.NewSSOService(repo, mapping, auditLogger), userService, sessionManager, cfg.OIDCPostLoginRedirect, auditLogger)
+}
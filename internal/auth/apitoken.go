@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const apiTokenPrefix = "blog_"
+
+// GenerateAPIToken returns a new personal API token and the hash under which
+// it is stored. The token itself is only shown to the user once.
+func GenerateAPIToken() (token string, hash string, err error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+
+	token = apiTokenPrefix + hex.EncodeToString(bytes)
+	return token, HashAPIToken(token), nil
+}
+
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const SessionCookieName = "session_id"
+
+// SessionFromRequest returns the session referenced by the request's signed
+// cookie. Cookies signed with one of the previous secrets are accepted and
+// re-signed with the current secret.
+func (sm *SessionManager) SessionFromRequest(w http.ResponseWriter, r *http.Request) (*Session, bool) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	sessionID, current, valid := (*sm).verifyCookieValue(cookie.Value)
+	if !valid {
+		return nil, false
+	}
+
+	session, exists := (*sm).GetSession(sessionID)
+	if !exists {
+		return nil, false
+	}
+
+	if !current {
+		(*sm).SetSessionCookie(w, session)
+	}
+
+	return session, true
+}
+
+// SetSessionCookie issues the cookie for the session. Only remembered
+// sessions get a persistent cookie, others end when the browser is closed.
+func (sm *SessionManager) SetSessionCookie(w http.ResponseWriter, session *Session) {
+	cookie := &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    (*sm).signSessionID(session.ID),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if session.Remember {
+		cookie.Expires = session.ExpiresAt
+	}
+	http.SetCookie(w, cookie)
+}
+
+func (sm *SessionManager) ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// -- helpers --
+func (sm *SessionManager) signSessionID(sessionID string) string {
+	return sessionID + "." + computeSignature((*sm).secret, sessionID)
+}
+
+// verifyCookieValue checks the signature against the current secret first and
+// then every previous one. current is false when an old secret matched.
+func (sm *SessionManager) verifyCookieValue(value string) (sessionID string, current bool, valid bool) {
+	idx := strings.LastIndexByte(value, '.')
+	if idx <= 0 {
+		return "", false, false
+	}
+	sessionID, signature := value[:idx], value[idx+1:]
+
+	if checkSignature((*sm).secret, sessionID, signature) {
+		return sessionID, true, true
+	}
+	for _, secret := range (*sm).previousSecrets {
+		if checkSignature(secret, sessionID, signature) {
+			return sessionID, false, true
+		}
+	}
+
+	return "", false, false
+}
+
+func computeSignature(secret, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func checkSignature(secret, value, signature string) bool {
+	return hmac.Equal([]byte(computeSignature(secret, value)), []byte(signature))
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTimeouts = SessionTimeouts{
+	Idle:     2 * time.Hour,
+	Absolute: 24 * time.Hour,
+	Remember: 30 * 24 * time.Hour,
+}
+
+// sessionCookieValue returns the value of the session cookie set on w.
+func sessionCookieValue(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == SessionCookieName {
+			return cookie.Value
+		}
+	}
+	t.Fatal("no session cookie was set")
+	return ""
+}
+
+func TestSessionCookieSigning(t *testing.T) {
+	store := NewMemoryStore()
+	old := NewSessionManager("old-secret", nil, store, testTimeouts)
+	rotated := NewSessionManager("new-secret", []string{"old-secret"}, store, testTimeouts)
+	other := NewSessionManager("other-secret", nil, store, testTimeouts)
+
+	session, err := old.CreateSession(1, ClientInfo{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	old.SetSessionCookie(w, session)
+	signed := sessionCookieValue(t, w)
+
+	tamperedID := "f" + signed[1:]
+	if signed[0] == 'f' {
+		tamperedID = "e" + signed[1:]
+	}
+
+	tests := []struct {
+		name    string
+		manager *SessionManager
+		value   string
+		wantOK  bool
+		// a cookie signed with the current secret is set in the response
+		wantResigned bool
+	}{
+		{name: "current secret", manager: old, value: signed, wantOK: true},
+		{name: "previous secret", manager: rotated, value: signed, wantOK: true, wantResigned: true},
+		{name: "unknown secret", manager: other, value: signed},
+		{name: "unsigned session id", manager: old, value: session.ID},
+		{name: "tampered session id", manager: old, value: tamperedID},
+		{name: "tampered signature", manager: old, value: signed[:len(signed)-2] + "xx"},
+		{name: "empty", manager: old, value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tt.value})
+			w := httptest.NewRecorder()
+
+			got, ok := tt.manager.SessionFromRequest(w, r)
+			if ok != tt.wantOK {
+				t.Fatalf("SessionFromRequest ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got.ID != session.ID {
+				t.Errorf("session = %s, want %s", got.ID, session.ID)
+			}
+
+			resigned := len(w.Result().Cookies()) > 0
+			if resigned != tt.wantResigned {
+				t.Fatalf("cookie reissued = %v, want %v", resigned, tt.wantResigned)
+			}
+			if resigned {
+				value := sessionCookieValue(t, w)
+				if value == signed || !strings.HasPrefix(value, session.ID+".") {
+					t.Errorf("reissued cookie %q is not the session signed with the new secret", value)
+				}
+				if _, _, current := tt.manager.verifyCookieValue(value); !current {
+					t.Error("reissued cookie is not signed with the current secret")
+				}
+			}
+		})
+	}
+}
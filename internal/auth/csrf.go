@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"net/http"
+)
+
+const CSRFHeaderName = "X-CSRF-Token"
+
+// CSRFToken returns the synchronizer token for the session. It is derived from
+// the session ID with the signing secret, so it needs no storage and changes
+// whenever the session does.
+func (sm *SessionManager) CSRFToken(session *Session) string {
+	return computeSignature((*sm).secret, "csrf:"+session.ID)
+}
+
+func (sm *SessionManager) checkCSRFToken(session *Session, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	if checkSignature((*sm).secret, "csrf:"+session.ID, token) {
+		return true
+	}
+	for _, secret := range (*sm).previousSecrets {
+		if checkSignature(secret, "csrf:"+session.ID, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// CSRFMiddleware rejects state-changing requests authenticated by the session
+// cookie unless they carry the session's token in the X-CSRF-Token header.
+// It must be used after AuthMiddleware.
+func CSRFMiddleware(sm *SessionManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			session, ok := GetSessionFromContext(r.Context())
+			if ok && !(*sm).checkCSRFToken(session, r.Header.Get(CSRFHeaderName)) {
+				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LoginAttempts struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type AttemptStore interface {
+	// RecordFailure increments the failure count of key and returns it. Counts
+	// last updated before resetBefore start over from one.
+	RecordFailure(key string, now, resetBefore time.Time) (int, error)
+	Lock(key string, until time.Time) error
+	// Get returns nil when there are no recorded attempts for key.
+	Get(key string) (*LoginAttempts, error)
+	ListLocked(now time.Time) ([]*LoginAttempts, error)
+	Reset(key string) error
+	// DeleteStale drops records last updated before updatedBefore which are
+	// not locked at now.
+	DeleteStale(updatedBefore, now time.Time) error
+}
+
+// LimitPolicy allows Threshold failures within Window, after which every
+// further failure locks the key out for BaseLockout, doubling each time up
+// to MaxLockout.
+type LimitPolicy struct {
+	Threshold   int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+func (p LimitPolicy) lockout(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	exponent := float64(failures - p.Threshold)
+	lockout := time.Duration(float64(p.BaseLockout) * math.Pow(2, exponent))
+	if lockout <= 0 || lockout > p.MaxLockout {
+		return p.MaxLockout
+	}
+	return lockout
+}
+
+var (
+	DefaultIPPolicy = LimitPolicy{
+		Threshold:   20,
+		Window:      time.Hour,
+		BaseLockout: time.Minute,
+		MaxLockout:  time.Hour,
+	}
+	DefaultAccountPolicy = LimitPolicy{
+		Threshold:   5,
+		Window:      time.Hour,
+		BaseLockout: 30 * time.Second,
+		MaxLockout:  30 * time.Minute,
+	}
+)
+
+// LoginLimiter tracks failed logins per client IP and per account.
+type LoginLimiter struct {
+	store         AttemptStore
+	ipPolicy      LimitPolicy
+	accountPolicy LimitPolicy
+	now           func() time.Time
+}
+
+func NewLoginLimiter(store AttemptStore, ipPolicy, accountPolicy LimitPolicy) *LoginLimiter {
+	return &LoginLimiter{
+		store:         store,
+		ipPolicy:      ipPolicy,
+		accountPolicy: accountPolicy,
+		now:           time.Now,
+	}
+}
+
+func IPAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+func AccountAttemptKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// Check returns how long the caller has to wait before trying again, or zero
+// when neither the IP nor the account is locked out.
+func (l *LoginLimiter) Check(ip, username string) (time.Duration, error) {
+	now := (*l).now()
+
+	var retryAfter time.Duration
+	for _, key := range []string{IPAttemptKey(ip), AccountAttemptKey(username)} {
+		attempts, err := (*l).store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if attempts == nil {
+			continue
+		}
+
+		if wait := attempts.LockedUntil.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	return retryAfter, nil
+}
+
+func (l *LoginLimiter) RecordFailure(ip, username string) error {
+	window := max((*l).ipPolicy.Window, (*l).accountPolicy.Window)
+	if err := (*l).store.DeleteStale((*l).now().Add(-window), (*l).now()); err != nil {
+		return err
+	}
+
+	if err := (*l).recordFailure(IPAttemptKey(ip), (*l).ipPolicy); err != nil {
+		return err
+	}
+	return (*l).recordFailure(AccountAttemptKey(username), (*l).accountPolicy)
+}
+
+// RecordSuccess forgets the account's failures. The IP's are kept, otherwise
+// logging into an own account would reset the counter for guessing others.
+func (l *LoginLimiter) RecordSuccess(username string) error {
+	return (*l).store.Reset(AccountAttemptKey(username))
+}
+
+func (l *LoginLimiter) ListLocked() ([]*LoginAttempts, error) {
+	return (*l).store.ListLocked((*l).now())
+}
+
+func (l *LoginLimiter) Clear(key string) error {
+	return (*l).store.Reset(key)
+}
+
+// -- helpers --
+func (l *LoginLimiter) recordFailure(key string, policy LimitPolicy) error {
+	now := (*l).now()
+
+	failures, err := (*l).store.RecordFailure(key, now, now.Add(-policy.Window))
+	if err != nil {
+		return err
+	}
+
+	if lockout := policy.lockout(failures); lockout > 0 {
+		return (*l).store.Lock(key, now.Add(lockout))
+	}
+	return nil
+}
+
+// MemoryAttemptStore keeps login attempts in process memory.
+type MemoryAttemptStore struct {
+	attempts map[string]*LoginAttempts
+	mutex    sync.Mutex
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]*LoginAttempts)}
+}
+
+func (s *MemoryAttemptStore) RecordFailure(key string, now, resetBefore time.Time) (int, error) {
+	(*s).mutex.Lock()
+	defer (*s).mutex.Unlock()
+
+	attempts, exists := (*s).attempts[key]
+	if !exists || attempts.UpdatedAt.Before(resetBefore) {
+		attempts = &LoginAttempts{Key: key}
+		(*s).attempts[key] = attempts
+	}
+
+	attempts.Failures++
+	attempts.UpdatedAt = now
+	return attempts.Failures, nil
+}
+
+func (s *MemoryAttemptStore) Lock(key string, until time.Time) error {
+	(*s).mutex.Lock()
+	if attempts, exists := (*s).attempts[key]; exists {
+		attempts.LockedUntil = until
+	}
+	(*s).mutex.Unlock()
+
+	return nil
+}
+
+func (s *MemoryAttemptStore) Get(key string) (*LoginAttempts, error) {
+	(*s).mutex.Lock()
+	defer (*s).mutex.Unlock()
+
+	attempts, exists := (*s).attempts[key]
+	if !exists {
+		return nil, nil
+	}
+
+	copied := *attempts
+	return &copied, nil
+}
+
+func (s *MemoryAttemptStore) ListLocked(now time.Time) ([]*LoginAttempts, error) {
+	(*s).mutex.Lock()
+	defer (*s).mutex.Unlock()
+
+	var locked []*LoginAttempts
+	for _, attempts := range (*s).attempts {
+		if attempts.LockedUntil.After(now) {
+			copied := *attempts
+			locked = append(locked, &copied)
+		}
+	}
+	return locked, nil
+}
+
+func (s *MemoryAttemptStore) Reset(key string) error {
+	(*s).mutex.Lock()
+	delete((*s).attempts, key)
+	(*s).mutex.Unlock()
+
+	return nil
+}
+
+func (s *MemoryAttemptStore) DeleteStale(updatedBefore, now time.Time) error {
+	(*s).mutex.Lock()
+	for key, attempts := range (*s).attempts {
+		if attempts.UpdatedAt.Before(updatedBefore) && !attempts.LockedUntil.After(now) {
+			delete((*s).attempts, key)
+		}
+	}
+	(*s).mutex.Unlock()
+
+	return nil
+}
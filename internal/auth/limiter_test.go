@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitPolicyLockout(t *testing.T) {
+	policy := DefaultAccountPolicy
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{10, 16 * time.Minute},
+		{11, 30 * time.Minute},
+		{100, 30 * time.Minute},
+		{10000, 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := policy.lockout(tt.failures); got != tt.want {
+			t.Errorf("lockout after %d failures = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	stores := map[string]func(t *testing.T) AttemptStore{
+		"memory": func(t *testing.T) AttemptStore { return NewMemoryAttemptStore() },
+		"sqlite": func(t *testing.T) AttemptStore { return NewSQLiteAttemptStore(newTestDB(t)) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+			limiter := NewLoginLimiter(newStore(t), DefaultIPPolicy, DefaultAccountPolicy)
+			(*limiter).now = func() time.Time { return now }
+
+			check := func(ip, username string, want time.Duration) {
+				t.Helper()
+				got, err := limiter.Check(ip, username)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Fatalf("Check(%s, %s) = %v, want %v", ip, username, got, want)
+				}
+			}
+			fail := func(ip, username string, times int) {
+				t.Helper()
+				for range times {
+					if err := limiter.RecordFailure(ip, username); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			// the account is locked on the fifth failure, regardless of case
+			fail("192.0.2.1", "alice", 4)
+			check("192.0.2.1", "alice", 0)
+			fail("192.0.2.2", "Alice", 1)
+			check("192.0.2.3", "alice", 30*time.Second)
+
+			// every further failure doubles the lockout
+			fail("192.0.2.2", "alice", 1)
+			check("192.0.2.3", "alice", time.Minute)
+
+			// a success forgets the account's failures
+			if err := limiter.RecordSuccess("ALICE"); err != nil {
+				t.Fatal(err)
+			}
+			check("192.0.2.3", "alice", 0)
+
+			// failures older than the window start over
+			fail("192.0.2.4", "bob", 4)
+			now = now.Add(DefaultAccountPolicy.Window + time.Minute)
+			fail("192.0.2.4", "bob", 1)
+			check("192.0.2.5", "bob", 0)
+
+			// an IP guessing many accounts is locked out for all of them
+			for i := range DefaultIPPolicy.Threshold {
+				fail("198.51.100.1", string(rune('a'+i))+"-user", 1)
+			}
+			check("198.51.100.1", "carol", DefaultIPPolicy.BaseLockout)
+			check("198.51.100.2", "carol", 0)
+
+			locked, err := limiter.ListLocked()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(locked) != 1 || locked[0].Key != IPAttemptKey("198.51.100.1") {
+				t.Errorf("locked keys = %v, want only the IP", locked)
+			}
+
+			if err := limiter.Clear(IPAttemptKey("198.51.100.1")); err != nil {
+				t.Fatal(err)
+			}
+			check("198.51.100.1", "carol", 0)
+		})
+	}
+}
@@ -3,34 +3,132 @@ package auth
 import (
 	"context"
 	"net/http"
+	"strings"
+
+	"blog-system/internal/domain"
 )
 
 type contextKey string
 
-const userContextKey contextKey = "user"
+const (
+	userContextKey     contextKey = "user"
+	sessionContextKey  contextKey = "session"
+	apiTokenContextKey contextKey = "api_token"
+	clientContextKey   contextKey = "client"
+)
 
-func AuthMiddleware(sm *SessionManager) func(http.Handler) http.Handler {
+type UserLookup interface {
+	GetUser(id int) (*domain.User, error)
+}
+
+type TokenAuthenticator interface {
+	// AuthenticateToken returns the owner of a valid, unexpired API token.
+	AuthenticateToken(token string) (*domain.User, *domain.APIToken, error)
+}
+
+// AuthMiddleware authenticates the request with either an
+// "Authorization: Bearer" API token or the session cookie.
+func AuthMiddleware(sm *SessionManager, users UserLookup, tokens TokenAuthenticator) func(http.Handler) http.Handler {
+	return authMiddleware(sm, users, tokens, true)
+}
+
+// OptionalAuthMiddleware identifies the user like AuthMiddleware but lets
+// requests without a valid session through anonymously. Invalid API tokens
+// are still rejected.
+func OptionalAuthMiddleware(sm *SessionManager, users UserLookup, tokens TokenAuthenticator) func(http.Handler) http.Handler {
+	return authMiddleware(sm, users, tokens, false)
+}
+
+func authMiddleware(sm *SessionManager, users UserLookup, tokens TokenAuthenticator, required bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cookie, err := r.Cookie("session_id")
-			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			if bearer, ok := bearerToken(r); ok {
+				user, token, err := tokens.AuthenticateToken(bearer)
+				if err != nil || user.Disabled {
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), userContextKey, user)
+				ctx = context.WithValue(ctx, apiTokenContextKey, token)
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			session, exists := (*sm).GetSession(cookie.Value)
+			unauthorized := func() {
+				if required {
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+			}
+
+			session, exists := (*sm).SessionFromRequest(w, r)
 			if !exists {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				unauthorized()
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), userContextKey, session.UserID)
+			user, err := users.GetUser(session.UserID)
+			if err != nil {
+				unauthorized()
+				return
+			}
+			if user.Disabled {
+				(*sm).DeleteSession(session.ID)
+				unauthorized()
+				return
+			}
+
+			// failing to record activity shouldn't fail the request
+			if renewed, err := (*sm).Touch(session); err == nil && renewed {
+				(*sm).SetSessionCookie(w, session)
+			}
+
+			ctx := context.WithValue(r.Context(), userContextKey, user)
+			ctx = context.WithValue(ctx, sessionContextKey, session)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func GetUserFromContext(ctx context.Context) (string, bool) {
-	userID, ok := ctx.Value(userContextKey).(string)
-	return userID, ok
+// ClientInfoMiddleware makes the client's IP and user agent available to
+// code that only gets the request context, such as services.
+func ClientInfoMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientContextKey, ClientInfoFromRequest(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func GetUserFromContext(ctx context.Context) (*domain.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*domain.User)
+	return user, ok
+}
+
+// GetSessionFromContext returns the session of cookie-authenticated requests.
+func GetSessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(sessionContextKey).(*Session)
+	return session, ok
+}
+
+// GetAPITokenFromContext returns the token of requests authenticated with one.
+func GetAPITokenFromContext(ctx context.Context) (*domain.APIToken, bool) {
+	token, ok := ctx.Value(apiTokenContextKey).(*domain.APIToken)
+	return token, ok
+}
+
+func GetClientInfoFromContext(ctx context.Context) (ClientInfo, bool) {
+	client, ok := ctx.Value(clientContextKey).(ClientInfo)
+	return client, ok
+}
+
+// -- helpers --
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
 }
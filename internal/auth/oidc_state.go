@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	oidcStateCookieName = "oidc_state"
+	oidcStateCookiePath = "/api/auth/oidc"
+	oidcStateTTL        = 10 * time.Minute
+)
+
+// OIDCLoginState is kept in a signed cookie between redirecting the browser
+// to the provider and the provider redirecting it back.
+type OIDCLoginState struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	Remember     bool
+}
+
+// NewOIDCLoginState generates fresh random state, nonce and PKCE verifier.
+func NewOIDCLoginState(remember bool) (*OIDCLoginState, string, error) {
+	state, err := randomURLString(16)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce, err := randomURLString(16)
+	if err != nil {
+		return nil, "", err
+	}
+	verifier, challenge, err := GeneratePKCE()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &OIDCLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Remember:     remember,
+	}, challenge, nil
+}
+
+func (sm *SessionManager) SetOIDCStateCookie(w http.ResponseWriter, state *OIDCLoginState) {
+	expiresAt := time.Now().Add(oidcStateTTL)
+	payload := strings.Join([]string{
+		"oidc",
+		state.State,
+		state.Nonce,
+		state.CodeVerifier,
+		strconv.FormatBool(state.Remember),
+		strconv.FormatInt(expiresAt.Unix(), 10),
+	}, "|")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	// Lax, since the provider redirects back with a top-level GET
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    encoded + "." + computeSignature((*sm).secret, encoded),
+		Path:     oidcStateCookiePath,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OIDCStateFromRequest returns the login state and clears its cookie, so that
+// every state can only be used once.
+func (sm *SessionManager) OIDCStateFromRequest(w http.ResponseWriter, r *http.Request) (*OIDCLoginState, bool) {
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Path:     oidcStateCookiePath,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	idx := strings.LastIndexByte(cookie.Value, '.')
+	if idx <= 0 {
+		return nil, false
+	}
+	encoded, signature := cookie.Value[:idx], cookie.Value[idx+1:]
+	if !checkSignature((*sm).secret, encoded, signature) {
+		return nil, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 6 || parts[0] != "oidc" {
+		return nil, false
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[5], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return nil, false
+	}
+
+	return &OIDCLoginState{
+		State:        parts[1],
+		Nonce:        parts[2],
+		CodeVerifier: parts[3],
+		Remember:     parts[4] == "true",
+	}, true
+}
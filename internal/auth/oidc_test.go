@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"blog-system/internal/auth/oidctest"
+)
+
+func TestOIDCExchange(t *testing.T) {
+	idp := oidctest.NewProvider("blog")
+	defer idp.Close()
+
+	tests := []struct {
+		name string
+		// the login at the provider
+		login oidctest.Login
+		// replaces the PKCE verifier sent to the token endpoint
+		verifier string
+		// replaces the nonce expected in the ID token
+		nonce     string
+		wantError bool
+	}{
+		{name: "RS256", login: oidctest.Login{Algorithm: "RS256"}},
+		{name: "ES256", login: oidctest.Login{Algorithm: "ES256"}},
+		{name: "bad RS256 signature", login: oidctest.Login{CorruptSignature: true}, wantError: true},
+		{name: "bad ES256 signature", login: oidctest.Login{Algorithm: "ES256", CorruptSignature: true}, wantError: true},
+		{name: "wrong audience", login: oidctest.Login{Claims: map[string]any{"aud": "someone-else"}}, wantError: true},
+		{name: "audience list", login: oidctest.Login{Claims: map[string]any{"aud": []string{"other", "blog"}}}},
+		{name: "wrong issuer", login: oidctest.Login{Claims: map[string]any{"iss": "https://evil.example.com"}}, wantError: true},
+		{name: "expired", login: oidctest.Login{Claims: map[string]any{"exp": time.Now().Add(-2 * oidcClockSkew).Unix()}}, wantError: true},
+		{name: "expired within clock skew", login: oidctest.Login{Claims: map[string]any{"exp": time.Now().Add(-oidcClockSkew / 2).Unix()}}},
+		{name: "missing expiry", login: oidctest.Login{Claims: map[string]any{"exp": nil}}, wantError: true},
+		{name: "issued in the future", login: oidctest.Login{Claims: map[string]any{"iat": time.Now().Add(time.Hour).Unix()}}, wantError: true},
+		{name: "nonce mismatch", nonce: "another-nonce", wantError: true},
+		{name: "missing nonce", login: oidctest.Login{Claims: map[string]any{"nonce": nil}}, wantError: true},
+		{name: "PKCE verifier mismatch", verifier: "another-verifier-another-verifier-another", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewOIDCProvider(OIDCConfig{
+				IssuerURL:   idp.URL(),
+				ClientID:    "blog",
+				RedirectURL: "http://blog.test/api/auth/oidc/callback",
+			}, nil)
+			idp.SetLogin(tt.login)
+
+			claims, err := authorizeAndExchange(provider, idp, tt.verifier, tt.nonce)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("Exchange accepted the login, claims %+v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "subject" {
+				t.Errorf("Subject = %q, want %q", claims.Subject, "subject")
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeErrors(t *testing.T) {
+	idp := oidctest.NewProvider("blog")
+	defer idp.Close()
+
+	provider := NewOIDCProvider(OIDCConfig{
+		IssuerURL:   idp.URL(),
+		ClientID:    "blog",
+		RedirectURL: "http://blog.test/api/auth/oidc/callback",
+	}, nil)
+
+	idp.SetLogin(oidctest.Login{CorruptSignature: true})
+	if _, err := authorizeAndExchange(provider, idp, "", ""); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("bad signature: err = %v, want ErrInvalidIDToken", err)
+	}
+
+	// the provider refuses the code, there is no ID token to check
+	idp.SetLogin(oidctest.Login{})
+	if _, err := authorizeAndExchange(provider, idp, "wrong-verifier", ""); err == nil || errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("wrong verifier: err = %v, want a token request error", err)
+	}
+}
+
+func TestOIDCClaims(t *testing.T) {
+	idp := oidctest.NewProvider("blog")
+	defer idp.Close()
+
+	provider := NewOIDCProvider(OIDCConfig{
+		IssuerURL:   idp.URL(),
+		ClientID:    "blog",
+		RedirectURL: "http://blog.test/api/auth/oidc/callback",
+		GroupsClaim: "roles",
+	}, nil)
+	idp.SetLogin(oidctest.Login{Claims: map[string]any{
+		"sub":                "jane-id",
+		"email":              "jane@example.com",
+		"email_verified":     "true",
+		"preferred_username": "jane",
+		"roles":              []string{"staff", "blog-editors"},
+	}})
+
+	claims, err := authorizeAndExchange(provider, idp, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "jane-id" || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.PreferredUsername != "jane" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if len(claims.Groups) != 2 || claims.Groups[0] != "staff" || claims.Groups[1] != "blog-editors" {
+		t.Errorf("Groups = %v, want [staff blog-editors]", claims.Groups)
+	}
+}
+
+// authorizeAndExchange runs the login flow against the stand-in provider. An
+// empty verifier or nonce uses the ones the login was started with.
+func authorizeAndExchange(provider *OIDCProvider, idp *oidctest.Provider, verifier, nonce string) (*OIDCClaims, error) {
+	ctx := context.Background()
+
+	state, challenge, err := NewOIDCLoginState(false)
+	if err != nil {
+		return nil, err
+	}
+	authURL, err := (*provider).AuthCodeURL(ctx, state.State, state.Nonce, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	callback, err := (*idp).Authorize(authURL)
+	if err != nil {
+		return nil, err
+	}
+	if callback.Query().Get("state") != state.State {
+		return nil, errors.New("provider did not return the state")
+	}
+
+	if verifier == "" {
+		verifier = state.CodeVerifier
+	}
+	if nonce == "" {
+		nonce = state.Nonce
+	}
+	return (*provider).Exchange(ctx, callback.Query().Get("code"), verifier, nonce)
+}
@@ -0,0 +1,275 @@
+// Package oidctest provides a stand-in OpenID Connect provider for tests.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	rsaKeyID = "rsa-key"
+	ecKeyID  = "ec-key"
+)
+
+// Login describes the user the provider logs in on authorization and how
+// their ID token is issued.
+type Login struct {
+	// Claims are merged over the defaults: iss, aud, sub, exp, iat and the
+	// nonce of the authorization request. A nil value removes the claim.
+	Claims map[string]any
+	// Algorithm is RS256 or ES256, RS256 when empty
+	Algorithm string
+	// CorruptSignature flips a bit of the ID token's signature
+	CorruptSignature bool
+}
+
+// Provider serves discovery, JWKS, authorization and token endpoints. Its
+// authorization endpoint logs the configured user in without asking, and
+// redirects straight back with a code.
+type Provider struct {
+	ClientID string
+
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mutex sync.Mutex
+	login Login
+	codes map[string]grant
+}
+
+type grant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	login       Login
+}
+
+func NewProvider(clientID string) *Provider {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	p := &Provider{
+		ClientID: clientID,
+		rsaKey:   rsaKey,
+		ecKey:    ecKey,
+		codes:    make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", (*p).discovery)
+	mux.HandleFunc("GET /jwks", (*p).jwks)
+	mux.HandleFunc("GET /authorize", (*p).authorize)
+	mux.HandleFunc("POST /token", (*p).token)
+	(*p).server = httptest.NewServer(mux)
+
+	return p
+}
+
+// URL is the issuer URL of the provider.
+func (p *Provider) URL() string {
+	return (*p).server.URL
+}
+
+func (p *Provider) Close() {
+	(*p).server.Close()
+}
+
+// SetLogin sets the user logged in by following authorizations.
+func (p *Provider) SetLogin(login Login) {
+	(*p).mutex.Lock()
+	defer (*p).mutex.Unlock()
+	(*p).login = login
+}
+
+// Authorize plays the browser visiting authURL: it returns the URL the
+// provider redirects back to, with the code and state.
+func (p *Provider) Authorize(authURL string) (*url.URL, error) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return resp.Location()
+}
+
+// -- endpoints --
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 (*p).URL(),
+		"authorization_endpoint": (*p).URL() + "/authorize",
+		"token_endpoint":         (*p).URL() + "/token",
+		"jwks_uri":               (*p).URL() + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	rsaPublic := (*p).rsaKey.PublicKey
+	ecPublic := (*p).ecKey.PublicKey
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": rsaKeyID,
+				"use": "sig",
+				"n":   encode(rsaPublic.N.Bytes()),
+				"e":   encode(big.NewInt(int64(rsaPublic.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": ecKeyID,
+				"use": "sig",
+				"crv": "P-256",
+				"x":   encode(ecPublic.X.FillBytes(make([]byte, 32))),
+				"y":   encode(ecPublic.Y.FillBytes(make([]byte, 32))),
+			},
+		},
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != (*p).ClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	(*p).mutex.Lock()
+	(*p).codes[code] = grant{
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		redirectURI: redirect.String(),
+		login:       (*p).login,
+	}
+	(*p).mutex.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	// codes work once, like at a real provider
+	(*p).mutex.Lock()
+	grant, exists := (*p).codes[r.PostForm.Get("code")]
+	delete((*p).codes, r.PostForm.Get("code"))
+	(*p).mutex.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !exists || encode(sum[:]) != grant.challenge || r.PostForm.Get("redirect_uri") != grant.redirectURI {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":   (*p).URL(),
+		"aud":   (*p).ClientID,
+		"sub":   "subject",
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"iat":   now.Unix(),
+		"nonce": grant.nonce,
+	}
+	for name, value := range grant.login.Claims {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     (*p).sign(grant.login, claims),
+	})
+}
+
+// -- helpers --
+func (p *Provider) sign(login Login, claims map[string]any) string {
+	algorithm, keyID := "RS256", rsaKeyID
+	if login.Algorithm == "ES256" {
+		algorithm, keyID = "ES256", ecKeyID
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "kid": keyID, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	if algorithm == "ES256" {
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, (*p).ecKey, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	} else {
+		signature, err = rsa.SignPKCS1v15(rand.Reader, (*p).rsaKey, crypto.SHA256, digest[:])
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if login.CorruptSignature {
+		signature[len(signature)-1] ^= 1
+	}
+	return signed + "." + encode(signature)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func randomString() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return encode(bytes)
+}
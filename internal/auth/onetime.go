@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Purposes of one-time tokens, a token issued for one cannot be redeemed for
+// another.
+const (
+	PurposeMagicLink     = "magic_link"
+	PurposePasswordReset = "password_reset"
+	PurposePreAuth       = "preauth"
+)
+
+// CreateOneTimeToken issues a signed token for userID that expires after ttl.
+// The signature only proves the token was issued by us, callers must record
+// its hash to make sure it is redeemed at most once.
+func (sm *SessionManager) CreateOneTimeToken(purpose string, userID int, ttl time.Duration) (string, time.Time, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	payload := fmt.Sprintf("%s|%d|%d|%s", purpose, userID, expiresAt.Unix(), hex.EncodeToString(nonce))
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return encoded + "." + computeSignature((*sm).secret, encoded), expiresAt, nil
+}
+
+// VerifyOneTimeToken checks the token's signature, purpose and expiry.
+func (sm *SessionManager) VerifyOneTimeToken(purpose, token string) (userID int, ok bool) {
+	idx := strings.LastIndexByte(token, '.')
+	if idx <= 0 {
+		return 0, false
+	}
+	encoded, signature := token[:idx], token[idx+1:]
+
+	if !checkSignature((*sm).secret, encoded, signature) {
+		return 0, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, false
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 4 || parts[0] != purpose {
+		return 0, false
+	}
+
+	userID, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, false
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return 0, false
+	}
+
+	return userID, true
+}
+
+func HashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
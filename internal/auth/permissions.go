@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"blog-system/internal/domain"
+)
+
+type Permission string
+
+const (
+	PermWriteArticles    Permission = "articles:write"
+	PermEditAnyArticle   Permission = "articles:edit_any"
+	PermModerateComments Permission = "comments:moderate"
+	PermManageUsers      Permission = "users:manage"
+	PermViewAuditLog     Permission = "audit:read"
+)
+
+var AllPermissions = []Permission{
+	PermWriteArticles,
+	PermEditAnyArticle,
+	PermModerateComments,
+	PermManageUsers,
+	PermViewAuditLog,
+}
+
+var rolePermissions = map[domain.Role][]Permission{
+	domain.RoleAdmin:     {PermWriteArticles, PermEditAnyArticle, PermModerateComments, PermManageUsers, PermViewAuditLog},
+	domain.RoleEditor:    {PermWriteArticles, PermEditAnyArticle, PermModerateComments},
+	domain.RoleAuthor:    {PermWriteArticles},
+	domain.RoleModerator: {PermModerateComments},
+}
+
+func HasPermission(user *domain.User, perm Permission) bool {
+	if user == nil {
+		return false
+	}
+
+	for _, p := range rolePermissions[user.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the authenticated request may use perm: the user's role
+// must grant it and, for API token requests, the token must be scoped for it.
+func Can(ctx context.Context, perm Permission) bool {
+	user, ok := GetUserFromContext(ctx)
+	if !ok || !HasPermission(user, perm) {
+		return false
+	}
+
+	if token, ok := GetAPITokenFromContext(ctx); ok {
+		return token.HasScope(string(perm))
+	}
+	return true
+}
+
+func ValidPermission(perm Permission) bool {
+	for _, p := range AllPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission must be used after AuthMiddleware.
+func RequirePermission(perm Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := GetUserFromContext(r.Context()); !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !Can(r.Context(), perm) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
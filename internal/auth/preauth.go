@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const preAuthTTL = 5 * time.Minute
+
+// CreatePreAuthToken issues a short-lived signed token proving that userID
+// passed the password check. It is exchanged for a real session once the
+// second factor has been verified. Like one-time tokens, callers must record
+// its hash to limit the attempts made with it and redeem it only once.
+func (sm *SessionManager) CreatePreAuthToken(userID int, remember bool) (string, time.Time, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(preAuthTTL)
+	payload := fmt.Sprintf("preauth|%d|%t|%d|%s", userID, remember, expiresAt.Unix(), hex.EncodeToString(nonce))
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return encoded + "." + computeSignature((*sm).secret, encoded), expiresAt, nil
+}
+
+func (sm *SessionManager) VerifyPreAuthToken(token string) (userID int, remember bool, ok bool) {
+	idx := strings.LastIndexByte(token, '.')
+	if idx <= 0 {
+		return 0, false, false
+	}
+	encoded, signature := token[:idx], token[idx+1:]
+
+	// pre-auth tokens live for minutes, no need to accept previous secrets
+	if !checkSignature((*sm).secret, encoded, signature) {
+		return 0, false, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, false, false
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 5 || parts[0] != "preauth" {
+		return 0, false, false
+	}
+
+	userID, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, false, false
+	}
+	remember = parts[2] == "true"
+
+	expiresAt, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return 0, false, false
+	}
+
+	return userID, remember, true
+}
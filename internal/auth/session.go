@@ -2,92 +2,210 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
-	"sync"
+	"net"
+	"net/http"
 	"time"
 )
 
+// last-seen timestamps are only written when older than this, so that every
+// authenticated request doesn't turn into a database write
+const lastSeenResolution = time.Minute
+
 type Session struct {
 	ID        string
-	UserID    string
+	UserID    int
 	CreatedAt time.Time
-	ExpiresAt time.Time
+	// ExpiresAt slides forward on activity but never past AbsoluteExpiresAt
+	ExpiresAt         time.Time
+	AbsoluteExpiresAt time.Time
+	Remember          bool
+	LastSeenAt        time.Time
+	IP                string
+	UserAgent         string
 }
 
-type SessionManager struct {
-	sessions map[string]*Session
-	mutex    sync.RWMutex
-	secret   string
+type SessionTimeouts struct {
+	Idle     time.Duration
+	Absolute time.Duration
+	Remember time.Duration
+}
+
+// Handle is a non-secret identifier for the session which can be shown to
+// users and used to revoke it.
+func (s *Session) Handle() string {
+	sum := sha256.Sum256([]byte((*s).ID))
+	return hex.EncodeToString(sum[:8])
 }
 
-func NewSessionManager(secret string) *SessionManager {
-	sm := &SessionManager{
-		sessions: make(map[string]*Session),
-		secret:   secret,
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+func ClientInfoFromRequest(r *http.Request) ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return ClientInfo{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
 	}
+}
 
-	// cleanup goroutine for expired sessions
-	go sm.cleanupExpiredSessions()
+type SessionManager struct {
+	store           SessionStore
+	secret          string
+	previousSecrets []string
+	timeouts        SessionTimeouts
+}
 
-	return sm
+// NewSessionManager signs cookies with secret. Cookies signed with any of
+// previousSecrets are still accepted, which allows rotating the secret
+// without logging everyone out.
+func NewSessionManager(secret string, previousSecrets []string, store SessionStore, timeouts SessionTimeouts) *SessionManager {
+	return &SessionManager{
+		store:           store,
+		secret:          secret,
+		previousSecrets: previousSecrets,
+		timeouts:        timeouts,
+	}
 }
 
-func (sm *SessionManager) CreateSession(userID string) (*Session, error) {
+// CreateSession starts a session for the user. Remembered sessions last for
+// the remember timeout, others expire after the idle timeout unless renewed
+// by activity.
+func (sm *SessionManager) CreateSession(userID int, client ClientInfo, remember bool) (*Session, error) {
 	sessionID, err := generateSessionID()
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
 	session := &Session{
-		ID:        sessionID,
-		UserID:    userID,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(24 * time.Hour), //24 hour expiration, todo: export to env
+		ID:         sessionID,
+		UserID:     userID,
+		CreatedAt:  now,
+		Remember:   remember,
+		LastSeenAt: now,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+	}
+	if remember {
+		session.AbsoluteExpiresAt = now.Add((*sm).timeouts.Remember)
+	} else {
+		session.AbsoluteExpiresAt = now.Add((*sm).timeouts.Absolute)
 	}
+	session.ExpiresAt = (*sm).nextExpiry(session, now)
 
-	(*sm).mutex.Lock()
-	(*sm).sessions[sessionID] = session
-	(*sm).mutex.Unlock()
+	// logins are rare enough to piggyback the expired session cleanup on them
+	if err := (*sm).store.DeleteExpired(now); err != nil {
+		return nil, err
+	}
+
+	if err := (*sm).store.Save(session); err != nil {
+		return nil, err
+	}
 
 	return session, nil
 }
 
 func (sm *SessionManager) GetSession(sessionID string) (*Session, bool) {
-	(*sm).mutex.RLock()
-	session, exists := (*sm).sessions[sessionID]
-	(*sm).mutex.RUnlock()
+	session, err := (*sm).store.Get(sessionID)
+	if err != nil {
+		return nil, false
+	}
 
-	if !exists || session.ExpiresAt.Before(time.Now()) {
-		if exists {
-			(*sm).DeleteSession(sessionID)
-		}
+	if session.ExpiresAt.Before(time.Now()) {
+		(*sm).DeleteSession(sessionID)
 		return nil, false
 	}
 
 	return session, true
 }
 
-func (sm *SessionManager) DeleteSession(sessionID string) {
-	(*sm).mutex.Lock()
-	delete(sm.sessions, sessionID)
-	(*sm).mutex.Unlock()
+// Touch records activity on the session and slides its expiry forward.
+// renewed reports whether ExpiresAt changed and the cookie should be reissued.
+func (sm *SessionManager) Touch(session *Session) (renewed bool, err error) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < lastSeenResolution {
+		return false, nil
+	}
+
+	expiresAt := (*sm).nextExpiry(session, now)
+	renewed = expiresAt.After(session.ExpiresAt)
+	if !renewed {
+		expiresAt = session.ExpiresAt
+	}
+
+	if err := (*sm).store.Touch(session.ID, now, expiresAt); err != nil {
+		return false, err
+	}
+
+	session.LastSeenAt = now
+	session.ExpiresAt = expiresAt
+	return renewed, nil
+}
+
+func (sm *SessionManager) ListUserSessions(userID int) ([]*Session, error) {
+	sessions, err := (*sm).store.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := make([]*Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.ExpiresAt.After(now) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
 }
 
-// -- helpers --
-func (sm *SessionManager) cleanupExpiredSessions() {
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		(*sm).mutex.Lock()
-		now := time.Now()
-		for id, session := range (*sm).sessions {
-			if session.ExpiresAt.Before(now) {
-				delete((*sm).sessions, id)
-			}
+// FindUserSession looks up one of the user's sessions by its handle.
+func (sm *SessionManager) FindUserSession(userID int, handle string) (*Session, bool) {
+	sessions, err := (*sm).ListUserSessions(userID)
+	if err != nil {
+		return nil, false
+	}
+
+	for _, session := range sessions {
+		if session.Handle() == handle {
+			return session, true
 		}
-		(*sm).mutex.Unlock()
 	}
+	return nil, false
+}
+
+func (sm *SessionManager) DeleteSession(sessionID string) error {
+	return (*sm).store.Delete(sessionID)
+}
+
+func (sm *SessionManager) DeleteUserSessions(userID int) error {
+	return (*sm).store.DeleteByUser(userID, "")
+}
+
+// DeleteOtherUserSessions revokes every session of the user except keepID.
+func (sm *SessionManager) DeleteOtherUserSessions(userID int, keepID string) error {
+	return (*sm).store.DeleteByUser(userID, keepID)
+}
+
+// -- helpers --
+func (sm *SessionManager) nextExpiry(session *Session, now time.Time) time.Time {
+	idle := (*sm).timeouts.Idle
+	if session.Remember {
+		idle = (*sm).timeouts.Remember
+	}
+
+	expiresAt := now.Add(idle)
+	if expiresAt.After(session.AbsoluteExpiresAt) {
+		return session.AbsoluteExpiresAt
+	}
+	return expiresAt
 }
 
 func generateSessionID() (string, error) {
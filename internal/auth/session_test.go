@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCreateSessionExpiry(t *testing.T) {
+	sm := NewSessionManager("secret", nil, NewMemoryStore(), testTimeouts)
+
+	tests := []struct {
+		name         string
+		remember     bool
+		wantExpiry   time.Duration
+		wantAbsolute time.Duration
+		// remembered sessions get a persistent cookie
+		wantPersistent bool
+	}{
+		{name: "session", wantExpiry: testTimeouts.Idle, wantAbsolute: testTimeouts.Absolute},
+		{name: "remembered", remember: true, wantExpiry: testTimeouts.Remember, wantAbsolute: testTimeouts.Remember, wantPersistent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := sm.CreateSession(1, ClientInfo{}, tt.remember)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := session.ExpiresAt.Sub(session.CreatedAt); got != tt.wantExpiry {
+				t.Errorf("expires after %v, want %v", got, tt.wantExpiry)
+			}
+			if got := session.AbsoluteExpiresAt.Sub(session.CreatedAt); got != tt.wantAbsolute {
+				t.Errorf("absolute expiry after %v, want %v", got, tt.wantAbsolute)
+			}
+
+			w := httptest.NewRecorder()
+			sm.SetSessionCookie(w, session)
+			cookie := w.Result().Cookies()[0]
+			if persistent := !cookie.Expires.IsZero(); persistent != tt.wantPersistent {
+				t.Errorf("persistent cookie = %v, want %v", persistent, tt.wantPersistent)
+			}
+		})
+	}
+}
+
+func TestTouchSlidesExpiry(t *testing.T) {
+	sm := NewSessionManager("secret", nil, NewMemoryStore(), testTimeouts)
+
+	tests := []struct {
+		name string
+		// how long ago the session was last seen and created
+		lastSeen time.Duration
+		created  time.Duration
+		// the expiry expected after Touch, relative to now
+		wantExpiry  time.Duration
+		wantRenewed bool
+	}{
+		{name: "recently seen", lastSeen: 10 * time.Second, created: time.Hour, wantExpiry: testTimeouts.Idle - 10*time.Second},
+		{name: "idle for a while", lastSeen: time.Hour, created: time.Hour, wantExpiry: testTimeouts.Idle, wantRenewed: true},
+		{name: "near the absolute expiry", lastSeen: time.Hour, created: testTimeouts.Absolute - time.Hour, wantExpiry: time.Hour, wantRenewed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			session := &Session{
+				ID:                tt.name,
+				UserID:            1,
+				CreatedAt:         now.Add(-tt.created),
+				LastSeenAt:        now.Add(-tt.lastSeen),
+				AbsoluteExpiresAt: now.Add(-tt.created).Add(testTimeouts.Absolute),
+			}
+			(*session).ExpiresAt = sm.nextExpiry(session, (*session).LastSeenAt)
+			if err := sm.store.Save(session); err != nil {
+				t.Fatal(err)
+			}
+
+			renewed, err := sm.Touch(session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if renewed != tt.wantRenewed {
+				t.Errorf("renewed = %v, want %v", renewed, tt.wantRenewed)
+			}
+
+			stored, err := sm.store.Get(session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stored.ExpiresAt.Sub(now); got < tt.wantExpiry-time.Second || got > tt.wantExpiry+time.Second {
+				t.Errorf("expires in %v, want %v", got, tt.wantExpiry)
+			}
+			if stored.ExpiresAt.After(stored.AbsoluteExpiresAt) {
+				t.Errorf("expiry %v is past the absolute expiry %v", stored.ExpiresAt, stored.AbsoluteExpiresAt)
+			}
+		})
+	}
+}
+
+func TestGetSessionExpired(t *testing.T) {
+	sm := NewSessionManager("secret", nil, NewMemoryStore(), testTimeouts)
+	now := time.Now()
+	session := &Session{ID: "expired", UserID: 1, CreatedAt: now.Add(-3 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+	if err := sm.store.Save(session); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exists := sm.GetSession(session.ID); exists {
+		t.Fatal("expired session was returned")
+	}
+	if _, err := sm.store.Get(session.ID); err == nil {
+		t.Error("expired session was not deleted")
+	}
+}
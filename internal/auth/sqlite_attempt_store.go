@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SQLiteAttemptStore keeps login attempts in the login_attempts table, so
+// lockouts are shared between instances using the same database.
+type SQLiteAttemptStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteAttemptStore(db *sql.DB) *SQLiteAttemptStore {
+	return &SQLiteAttemptStore{db: db}
+}
+
+func (s *SQLiteAttemptStore) RecordFailure(key string, now, resetBefore time.Time) (int, error) {
+	query := `INSERT INTO login_attempts (key, failures, updated_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN updated_at < ? THEN 1 ELSE failures + 1 END,
+			updated_at = excluded.updated_at
+		RETURNING failures`
+
+	var failures int
+	err := (*s).db.QueryRow(query, key, now.UTC(), resetBefore.UTC()).Scan(&failures)
+	return failures, err
+}
+
+func (s *SQLiteAttemptStore) Lock(key string, until time.Time) error {
+	_, err := (*s).db.Exec(`UPDATE login_attempts SET locked_until = ? WHERE key = ?`, until.UTC(), key)
+	return err
+}
+
+func (s *SQLiteAttemptStore) Get(key string) (*LoginAttempts, error) {
+	query := `SELECT key, failures, locked_until, updated_at FROM login_attempts WHERE key = ?`
+	attempts, err := scanLoginAttempts((*s).db.QueryRow(query, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return attempts, err
+}
+
+func (s *SQLiteAttemptStore) ListLocked(now time.Time) ([]*LoginAttempts, error) {
+	query := `SELECT key, failures, locked_until, updated_at FROM login_attempts
+		WHERE locked_until > ? ORDER BY locked_until DESC`
+	rows, err := (*s).db.Query(query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locked []*LoginAttempts
+	for rows.Next() {
+		attempts, err := scanLoginAttempts(rows)
+		if err != nil {
+			return nil, err
+		}
+		locked = append(locked, attempts)
+	}
+
+	return locked, rows.Err()
+}
+
+func (s *SQLiteAttemptStore) Reset(key string) error {
+	_, err := (*s).db.Exec(`DELETE FROM login_attempts WHERE key = ?`, key)
+	return err
+}
+
+func (s *SQLiteAttemptStore) DeleteStale(updatedBefore, now time.Time) error {
+	query := `DELETE FROM login_attempts WHERE updated_at < ? AND (locked_until IS NULL OR locked_until <= ?)`
+	_, err := (*s).db.Exec(query, updatedBefore.UTC(), now.UTC())
+	return err
+}
+
+// -- helpers --
+func scanLoginAttempts(row rowScanner) (*LoginAttempts, error) {
+	var attempts LoginAttempts
+	var lockedUntil sql.NullTime
+	err := row.Scan(
+		&attempts.Key,
+		&attempts.Failures,
+		&lockedUntil,
+		&attempts.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts.LockedUntil = lockedUntil.Time
+	return &attempts, nil
+}
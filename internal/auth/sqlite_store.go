@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SQLiteStore persists sessions in the sessions table so they survive
+// restarts and can be shared between instances using the same database.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (s *SQLiteStore) Save(session *Session) error {
+	query := `INSERT INTO sessions (id, user_id, created_at, expires_at, absolute_expires_at, remember, last_seen_at, ip, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at, last_seen_at = excluded.last_seen_at`
+	_, err := (*s).db.Exec(query,
+		(*session).ID,
+		(*session).UserID,
+		(*session).CreatedAt.UTC(),
+		(*session).ExpiresAt.UTC(),
+		(*session).AbsoluteExpiresAt.UTC(),
+		(*session).Remember,
+		(*session).LastSeenAt.UTC(),
+		(*session).IP,
+		(*session).UserAgent)
+	return err
+}
+
+func (s *SQLiteStore) Get(id string) (*Session, error) {
+	query := `SELECT id, user_id, created_at, expires_at, absolute_expires_at, remember, last_seen_at, ip, user_agent FROM sessions WHERE id = ?`
+	session, err := scanSession((*s).db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (s *SQLiteStore) ListByUser(userID int) ([]*Session, error) {
+	query := `SELECT id, user_id, created_at, expires_at, absolute_expires_at, remember, last_seen_at, ip, user_agent FROM sessions
+		WHERE user_id = ? ORDER BY created_at DESC`
+	rows, err := (*s).db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *SQLiteStore) Touch(id string, lastSeen, expiresAt time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?`
+	_, err := (*s).db.Exec(query, lastSeen.UTC(), expiresAt.UTC(), id)
+	return err
+}
+
+func (s *SQLiteStore) Delete(id string) error {
+	_, err := (*s).db.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLiteStore) DeleteByUser(userID int, exceptID string) error {
+	_, err := (*s).db.Exec(`DELETE FROM sessions WHERE user_id = ? AND id != ?`, userID, exceptID)
+	return err
+}
+
+func (s *SQLiteStore) DeleteExpired(now time.Time) error {
+	_, err := (*s).db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, now.UTC())
+	return err
+}
+
+// -- helpers --
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	var session Session
+	var absoluteExpiry, lastSeen sql.NullTime
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+		&absoluteExpiry,
+		&session.Remember,
+		&lastSeen,
+		&session.IP,
+		&session.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	// sessions created before sliding expiry have a fixed lifetime
+	session.AbsoluteExpiresAt = session.ExpiresAt
+	if absoluteExpiry.Valid {
+		session.AbsoluteExpiresAt = absoluteExpiry.Time
+	}
+
+	session.LastSeenAt = session.CreatedAt
+	if lastSeen.Valid {
+		session.LastSeenAt = lastSeen.Time
+	}
+	return &session, nil
+}
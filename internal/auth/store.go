@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionStore interface {
+	Save(session *Session) error
+	Get(id string) (*Session, error)
+	ListByUser(userID int) ([]*Session, error)
+	Touch(id string, lastSeen, expiresAt time.Time) error
+	Delete(id string) error
+	// DeleteByUser removes all sessions of the user except exceptID, which may be empty
+	DeleteByUser(userID int, exceptID string) error
+	DeleteExpired(now time.Time) error
+}
+
+// MemoryStore keeps sessions in process memory, they are lost on restart.
+type MemoryStore struct {
+	sessions map[string]*Session
+	mutex    sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*Session)}
+}
+
+func (s *MemoryStore) Save(session *Session) error {
+	copied := *session
+
+	(*s).mutex.Lock()
+	(*s).sessions[session.ID] = &copied
+	(*s).mutex.Unlock()
+
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Session, error) {
+	(*s).mutex.RLock()
+	session, exists := (*s).sessions[id]
+	(*s).mutex.RUnlock()
+
+	if !exists {
+		return nil, ErrSessionNotFound
+	}
+
+	copied := *session
+	return &copied, nil
+}
+
+func (s *MemoryStore) ListByUser(userID int) ([]*Session, error) {
+	(*s).mutex.RLock()
+	defer (*s).mutex.RUnlock()
+
+	var sessions []*Session
+	for _, session := range (*s).sessions {
+		if session.UserID == userID {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (s *MemoryStore) Touch(id string, lastSeen, expiresAt time.Time) error {
+	(*s).mutex.Lock()
+	if session, exists := (*s).sessions[id]; exists {
+		session.LastSeenAt = lastSeen
+		session.ExpiresAt = expiresAt
+	}
+	(*s).mutex.Unlock()
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	(*s).mutex.Lock()
+	delete((*s).sessions, id)
+	(*s).mutex.Unlock()
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteByUser(userID int, exceptID string) error {
+	(*s).mutex.Lock()
+	for id, session := range (*s).sessions {
+		if session.UserID == userID && id != exceptID {
+			delete((*s).sessions, id)
+		}
+	}
+	(*s).mutex.Unlock()
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpired(now time.Time) error {
+	(*s).mutex.Lock()
+	for id, session := range (*s).sessions {
+		if session.ExpiresAt.Before(now) {
+			delete((*s).sessions, id)
+		}
+	}
+	(*s).mutex.Unlock()
+
+	return nil
+}
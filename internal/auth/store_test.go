@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blog-system/pkg/database"
+)
+
+// newTestDB returns a fresh database with the users 1 and 2, which sessions
+// and other per-user rows have to reference.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "blog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := db.Exec(`INSERT INTO users (username, password_hash) VALUES (?, '')`, username); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestSessionStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) SessionStore{
+		"memory": func(t *testing.T) SessionStore { return NewMemoryStore() },
+		"sqlite": func(t *testing.T) SessionStore { return NewSQLiteStore(newTestDB(t)) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			testSessionStore(t, newStore(t))
+		})
+	}
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	sessions := []*Session{
+		{ID: "a1", UserID: 1, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour), IP: "192.0.2.1", UserAgent: "curl"},
+		{ID: "a2", UserID: 1, CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour), Remember: true},
+		{ID: "a3", UserID: 1, CreatedAt: now.Add(-3 * time.Hour), ExpiresAt: now.Add(-time.Minute)},
+		{ID: "b1", UserID: 2, CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+	}
+	for _, session := range sessions {
+		(*session).AbsoluteExpiresAt = (*session).ExpiresAt.Add(time.Hour)
+		(*session).LastSeenAt = (*session).CreatedAt
+		if err := store.Save(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := store.Get("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ExpiresAt.Equal(sessions[0].ExpiresAt) || !got.AbsoluteExpiresAt.Equal(sessions[0].AbsoluteExpiresAt) ||
+		got.UserID != 1 || got.IP != "192.0.2.1" || got.UserAgent != "curl" || got.Remember {
+		t.Errorf("Get returned %+v, want %+v", got, sessions[0])
+	}
+	if _, err := store.Get("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Get of a missing session: error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	// newest first
+	assertSessionIDs(t, store, 1, "a2", "a1", "a3")
+
+	lastSeen, expiresAt := now, now.Add(2*time.Hour)
+	if err := store.Touch("a1", lastSeen, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Get("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.LastSeenAt.Equal(lastSeen) || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("after Touch: last seen %v, expires %v, want %v and %v", got.LastSeenAt, got.ExpiresAt, lastSeen, expiresAt)
+	}
+
+	if err := store.DeleteExpired(now); err != nil {
+		t.Fatal(err)
+	}
+	assertSessionIDs(t, store, 1, "a2", "a1")
+
+	if err := store.DeleteByUser(1, "a1"); err != nil {
+		t.Fatal(err)
+	}
+	assertSessionIDs(t, store, 1, "a1")
+	assertSessionIDs(t, store, 2, "b1")
+
+	if err := store.Delete("a1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteByUser(2, ""); err != nil {
+		t.Fatal(err)
+	}
+	assertSessionIDs(t, store, 1)
+	assertSessionIDs(t, store, 2)
+}
+
+func assertSessionIDs(t *testing.T, store SessionStore, userID int, want ...string) {
+	t.Helper()
+
+	sessions, err := store.ListByUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, session := range sessions {
+		got = append(got, session.ID)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sessions of user %d = %v, want %v", userID, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("sessions of user %d = %v, want %v", userID, got, want)
+		}
+	}
+}
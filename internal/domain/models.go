@@ -3,14 +3,152 @@ package domain
 import "time"
 
 type Article struct {
-	ID        int        `json:"id"`
-	Title     string     `json:"title"`
-	Content   string     `json:"content"`
-	Author    string     `json:"author"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	Tags      []*Tag     `json:"tags,omitempty"`
-	Comments  []*Comment `json:"comments,omitempty"`
+	ID           int           `json:"id"`
+	Title        string        `json:"title"`
+	Slug         string        `json:"slug"`
+	Content      string        `json:"content"`
+	ContentHTML  string        `json:"content_html"`
+	TOC          []*TOCEntry   `json:"toc"`
+	Author       string        `json:"author"`
+	AuthorID     int           `json:"author_id,omitempty"`
+	Status       ArticleStatus `json:"status"`
+	PublishedAt  *time.Time    `json:"published_at"`
+	PublishAt    *time.Time    `json:"publish_at,omitempty"`
+	UnpublishAt  *time.Time    `json:"unpublish_at,omitempty"`
+	ScheduledBy  int           `json:"scheduled_by,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	Tags         []*Tag        `json:"tags,omitempty"`
+	CommentCount int           `json:"comment_count"`
+	Comments     []*Comment    `json:"comments,omitempty"`
+
+	// RenderVersion is the markdown.Version ContentHTML and TOC were rendered with
+	RenderVersion int `json:"-"`
+}
+
+// TOCEntry is a heading in the table of contents of an article, Anchor is
+// the id of the heading in ContentHTML.
+type TOCEntry struct {
+	Level    int         `json:"level"`
+	Text     string      `json:"text"`
+	Anchor   string      `json:"anchor"`
+	Children []*TOCEntry `json:"children,omitempty"`
+}
+
+type ArticleStatus string
+
+const (
+	ArticleDraft     ArticleStatus = "draft"
+	ArticlePublished ArticleStatus = "published"
+	ArticleArchived  ArticleStatus = "archived"
+)
+
+func (s ArticleStatus) Valid() bool {
+	switch s {
+	case ArticleDraft, ArticlePublished, ArticleArchived:
+		return true
+	}
+	return false
+}
+
+// ScheduledChange is an upcoming automatic publish or unpublish.
+type ScheduledChange struct {
+	ArticleID   int       `json:"article_id"`
+	Title       string    `json:"title"`
+	Action      string    `json:"action"`
+	At          time.Time `json:"at"`
+	ScheduledBy int       `json:"scheduled_by,omitempty"`
+}
+
+// ArticleSort is the order articles are listed in, ties are broken by id.
+type ArticleSort string
+
+const (
+	SortCreated   ArticleSort = "created"
+	SortUpdated   ArticleSort = "updated"
+	SortPublished ArticleSort = "published"
+	SortTitle     ArticleSort = "title"
+)
+
+func (s ArticleSort) Valid() bool {
+	switch s {
+	case SortCreated, SortUpdated, SortPublished, SortTitle:
+		return true
+	}
+	return false
+}
+
+// ArticleQuery selects a page of articles, zero fields match everything. An
+// empty Sort means SortPublished, and Since and Until apply to the date that
+// is sorted by, the published date when sorting by title. Limit 0 returns
+// every article. At most one of After and Before is set, to continue from an
+// article of a previous page.
+type ArticleQuery struct {
+	Status    ArticleStatus
+	AuthorID  int
+	Author    string
+	Tag       string
+	Since     time.Time
+	Until     time.Time
+	Sort      ArticleSort
+	Ascending bool
+	Limit     int
+	After     *ArticleCursor
+	Before    *ArticleCursor
+}
+
+// ArticleCursor is the position of an article in a listing, Key is its
+// value of the sorted column.
+type ArticleCursor struct {
+	Key string
+	ID  int
+}
+
+// ArticlePage is the result of an ArticleQuery. Total counts every matching
+// article, Next and Prev are nil when there are no more articles that way.
+type ArticlePage struct {
+	Articles []*Article
+	Total    int
+	Next     *ArticleCursor
+	Prev     *ArticleCursor
+}
+
+// SearchQuery is a full-text search among the articles matching Status,
+// Author and Tag, zero fields match everything.
+type SearchQuery struct {
+	Text   string
+	Status ArticleStatus
+	Author string
+	Tag    string
+	Limit  int
+	Offset int
+}
+
+// SearchResult is an article found by a search, best matches first. Title
+// and Snippet are HTML with the matched words in <mark> elements.
+type SearchResult struct {
+	ArticleID   int        `json:"article_id"`
+	Slug        string     `json:"slug"`
+	Title       string     `json:"title"`
+	Snippet     string     `json:"snippet"`
+	Author      string     `json:"author"`
+	PublishedAt *time.Time `json:"published_at"`
+	Tags        []*Tag     `json:"tags"`
+	Score       float64    `json:"score"`
+}
+
+// ArticleRevision is a snapshot of an article, taken on every change to its
+// title or content. Revisions are numbered from 1 for each article.
+type ArticleRevision struct {
+	ID         int       `json:"id"`
+	ArticleID  int       `json:"article_id"`
+	Revision   int       `json:"revision"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content,omitempty"`
+	Tags       []string  `json:"tags"`
+	AuthorID   int       `json:"author_id,omitempty"`
+	AuthorName string    `json:"author_name"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 type Comment struct {
@@ -25,3 +163,90 @@ type Tag struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
 }
+
+// TagUsage is a tag with the number of published articles that have it.
+type TagUsage struct {
+	Tag
+	ArticleCount int `json:"article_count"`
+}
+
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleEditor    Role = "editor"
+	RoleAuthor    Role = "author"
+	RoleModerator Role = "moderator"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleAdmin, RoleEditor, RoleAuthor, RoleModerator:
+		return true
+	}
+	return false
+}
+
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email,omitempty"`
+	OIDCSubject  string    `json:"-"`
+	SSOManaged   bool      `json:"sso_managed"`
+	PasswordHash string    `json:"-"`
+	Role         Role      `json:"role"`
+	Disabled     bool      `json:"disabled"`
+	TOTPEnabled  bool      `json:"totp_enabled"`
+	TOTPSecret   string    `json:"-"`
+	TOTPLastStep int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditEvent records a security relevant action. Before and After are short
+// JSON summaries of the target's state around the action.
+type AuditEvent struct {
+	ID         int       `json:"id"`
+	ActorID    int       `json:"actor_id,omitempty"`
+	ActorName  string    `json:"actor_name"`
+	IP         string    `json:"ip"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type,omitempty"`
+	TargetID   string    `json:"target_id,omitempty"`
+	Before     string    `json:"before,omitempty"`
+	After      string    `json:"after,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditFilter selects audit events, zero fields match everything. An Action
+// ending in "*" matches by prefix.
+type AuditFilter struct {
+	Action     string
+	ActorID    int
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+type AuditHandler struct {
+	audit *service.AuditLogger
+}
+
+func NewAuditHandler(audit *service.AuditLogger) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+func (h *AuditHandler) RegisterRoutes(r *mux.Router, protect mux.MiddlewareFunc) {
+	admin := (*r).PathPrefix("/admin/audit").Subrouter()
+	(*admin).Use(protect)
+	(*admin).Use(auth.RequirePermission(auth.PermViewAuditLog))
+
+	(*admin).HandleFunc("", (*h).GetEvents).Methods("GET")
+	(*admin).HandleFunc("/export", (*h).ExportEvents).Methods("GET")
+}
+
+// GetEvents returns a page of events, newest first. Filters: action (a
+// trailing * matches by prefix), actor_id, target_type, target_id, and since
+// and until as RFC 3339 times or dates. Pages are chosen with page and
+// per_page.
+func (h *AuditHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := parseAuditFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := positiveQueryInt(query, "page", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	perPage, err := positiveQueryInt(query, "per_page", defaultAuditPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	perPage = min(perPage, maxAuditPageSize)
+
+	filter.Limit = perPage
+	filter.Offset = (page - 1) * perPage
+
+	events, total, err := (*h).audit.GetEvents(filter)
+	if err != nil {
+		http.Error(w, "Failed to load audit events", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []*domain.AuditEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events":   events,
+		"total":    total,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+// ExportEvents downloads every event matching the filters of GetEvents, as
+// ?format=csv (the default) or ?format=json.
+func (h *AuditHandler) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := parseAuditFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405")
+
+	switch query.Get("format") {
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		(*h).exportCSV(w, filter)
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		(*h).exportJSON(w, filter)
+	default:
+		http.Error(w, "format must be either csv or json", http.StatusBadRequest)
+	}
+}
+
+// -- helpers --
+
+// the response is streamed, errors after the first row can only cut it short
+func (h *AuditHandler) exportCSV(w http.ResponseWriter, filter domain.AuditFilter) {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "created_at", "actor_id", "actor_name", "ip", "action", "target_type", "target_id", "before", "after"})
+
+	(*h).audit.ExportEvents(filter, func(event *domain.AuditEvent) error {
+		actorID := ""
+		if event.ActorID != 0 {
+			actorID = strconv.Itoa(event.ActorID)
+		}
+
+		return writer.Write([]string{
+			strconv.Itoa(event.ID),
+			event.CreatedAt.UTC().Format(time.RFC3339),
+			actorID,
+			csvSafe(event.ActorName),
+			event.IP,
+			event.Action,
+			csvSafe(event.TargetType),
+			csvSafe(event.TargetID),
+			csvSafe(event.Before),
+			csvSafe(event.After),
+		})
+	})
+
+	writer.Flush()
+}
+
+func (h *AuditHandler) exportJSON(w http.ResponseWriter, filter domain.AuditFilter) {
+	w.Write([]byte("["))
+
+	first := true
+	(*h).audit.ExportEvents(filter, func(event *domain.AuditEvent) error {
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if !first {
+			w.Write([]byte(","))
+		}
+		first = false
+
+		_, err = w.Write(encoded)
+		return err
+	})
+
+	w.Write([]byte("]\n"))
+}
+
+func parseAuditFilter(query url.Values) (domain.AuditFilter, error) {
+	filter := domain.AuditFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+	}
+
+	if actorID := query.Get("actor_id"); actorID != "" {
+		id, err := strconv.Atoi(actorID)
+		if err != nil {
+			return filter, fmt.Errorf("invalid actor_id")
+		}
+		filter.ActorID = id
+	}
+
+	var err error
+	if filter.Since, err = parseQueryTime(query, "since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseQueryTime(query, "until"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseQueryTime accepts RFC 3339 times and plain dates, meaning midnight UTC.
+func parseQueryTime(query url.Values, key string) (time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", key)
+}
+
+func positiveQueryInt(query url.Values, key string, fallback int) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", key)
+	}
+	return n, nil
+}
+
+// csvSafe keeps spreadsheet applications from evaluating user-controlled
+// values, such as attempted usernames, as formulas.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blog-system/internal/domain"
+	"blog-system/internal/service"
+)
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"alice", "alice"},
+		{"=1+1", "'=1+1"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+	}
+
+	for _, tt := range tests {
+		if got := csvSafe(tt.value); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExportAuditCSV(t *testing.T) {
+	s := newTestServer(t)
+	admin := (*s).createUser(t, "admin", domain.RoleAdmin)
+	token := (*s).createToken(t, admin, "audit:read")
+
+	// attempted usernames end up in the log as they were typed
+	formula := `=HYPERLINK("http://evil.example.com","click")`
+	body := fmt.Sprintf(`{"username": %q, "password": "wrong"}`, formula)
+	(*s).serve(httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(body)))
+
+	r := httptest.NewRequest("GET", "/api/admin/audit/export?action="+service.AuditLoginFailed, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := (*s).serve(r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Content-Type = %q, want text/csv", contentType)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d CSV records, want the header and one event", len(records))
+	}
+	if actorName := records[1][3]; actorName != "'"+formula {
+		t.Errorf("actor_name = %q, want it escaped as %q", actorName, "'"+formula)
+	}
+}
+
+func TestGetAuditEvents(t *testing.T) {
+	s := newTestServer(t)
+	admin := (*s).createUser(t, "admin", domain.RoleAdmin)
+	author := (*s).createUser(t, "author", domain.RoleAuthor)
+	token := (*s).createToken(t, admin, "audit:read")
+
+	(*s).login("author", "correct horse battery")
+	(*s).login("author", "wrong")
+	(*s).login("admin", "correct horse battery")
+
+	get := func(query string) []domain.AuditEvent {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/api/admin/audit?"+query, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := (*s).serve(r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", query, w.Code, http.StatusOK, w.Body)
+		}
+
+		var page struct {
+			Events []domain.AuditEvent `json:"events"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		return page.Events
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "action=auth.*", want: []string{service.AuditLogin, service.AuditLoginFailed, service.AuditLogin}},
+		{query: "action=" + service.AuditLogin, want: []string{service.AuditLogin, service.AuditLogin}},
+		{query: fmt.Sprintf("actor_id=%d", author.ID), want: []string{service.AuditLogin}},
+		{query: "action=auth.*&per_page=1&page=2", want: []string{service.AuditLoginFailed}},
+		{query: "since=2999-01-01", want: nil},
+	}
+
+	for _, tt := range tests {
+		events := get(tt.query)
+		var got []string
+		for _, event := range events {
+			got = append(got, event.Action)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: events %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// only admins can read the log
+	r := (*s).sessionRequest((*s).createSession(t, author), "GET", "/api/admin/audit", "")
+	if w := (*s).serve(r); w.Code != http.StatusForbidden {
+		t.Errorf("author: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	s := newTestServer(t)
+	(*s).login("nobody", "wrong")
+
+	if _, err := (*s).db.Exec(`UPDATE audit_events SET actor_name = 'someone else'`); err == nil {
+		t.Error("audit event was updated")
+	}
+	if _, err := (*s).db.Exec(`DELETE FROM audit_events`); err == nil {
+		t.Error("audit event was deleted")
+	}
+}
@@ -2,35 +2,67 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/service"
 
 	"github.com/gorilla/mux"
 )
 
 type AuthHandler struct {
-	sessionManager *auth.SessionManager
-	adminPassword  string
+	sessionManager   *auth.SessionManager
+	userService      *service.UserService
+	loginLimiter     *auth.LoginLimiter
+	magicLinkService *service.MagicLinkService
+	audit            *service.AuditLogger
 }
 
-func NewAuthHandler(sessionManager *auth.SessionManager, adminPassword string) *AuthHandler {
+func NewAuthHandler(sessionManager *auth.SessionManager, userService *service.UserService, loginLimiter *auth.LoginLimiter, magicLinkService *service.MagicLinkService, audit *service.AuditLogger) *AuthHandler {
 	return &AuthHandler{
-		sessionManager: sessionManager,
-		adminPassword:  adminPassword,
+		sessionManager:   sessionManager,
+		userService:      userService,
+		loginLimiter:     loginLimiter,
+		magicLinkService: magicLinkService,
+		audit:            audit,
 	}
 }
 
-func (h *AuthHandler) RegisterRoutes(r *mux.Router) {
+func (h *AuthHandler) RegisterRoutes(r *mux.Router, protect mux.MiddlewareFunc) {
+	protected := (*r).PathPrefix("").Subrouter()
+	(*protected).Use(protect)
+	(*protected).Use(requireSession)
+
 	(*r).HandleFunc("/auth/login", (*h).Login).Methods("POST")
-	(*r).HandleFunc("/auth/logout", (*h).Logout).Methods("POST")
+	(*r).HandleFunc("/auth/login/2fa", (*h).LoginSecondFactor).Methods("POST")
 	(*r).HandleFunc("/auth/status", (*h).Status).Methods("GET")
+	(*r).HandleFunc("/auth/magic-link", (*h).RequestMagicLink).Methods("POST")
+	(*r).HandleFunc("/auth/magic-link/verify", (*h).VerifyMagicLink).Methods("POST")
+	(*protected).HandleFunc("/auth/logout", (*h).Logout).Methods("POST")
+	(*protected).HandleFunc("/auth/csrf", (*h).CSRFToken).Methods("GET")
+
+	twoFactorPath := "/auth/2fa"
+	(*protected).HandleFunc(twoFactorPath+"/setup", (*h).SetupTwoFactor).Methods("POST")
+	(*protected).HandleFunc(twoFactorPath+"/enable", (*h).EnableTwoFactor).Methods("POST")
+	(*protected).HandleFunc(twoFactorPath+"/disable", (*h).DisableTwoFactor).Methods("POST")
+	(*protected).HandleFunc(twoFactorPath+"/recovery-codes", (*h).RegenerateRecoveryCodes).Methods("POST")
+
+	sessionStemPath := "/auth/sessions"
+	(*protected).HandleFunc(sessionStemPath, (*h).ListSessions).Methods("GET")
+	(*protected).HandleFunc(sessionStemPath, (*h).RevokeOtherSessions).Methods("DELETE")
+	(*protected).HandleFunc(sessionStemPath+"/{session:[0-9a-f]+}", (*h).RevokeSession).Methods("DELETE")
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Password string `json:"password"`
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		RememberMe bool   `json:"remember_me"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -38,49 +70,68 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Password != (*h).adminPassword {
-		http.Error(w, "Invalid password", http.StatusUnauthorized)
+	client := auth.ClientInfoFromRequest(r)
+	retryAfter, err := (*h).loginLimiter.Check(client.IP, req.Username)
+	if err != nil {
+		http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		(*h).recordLoginFailure(r, nil, req.Username, "throttled")
+		writeTooManyAttempts(w, retryAfter)
 		return
 	}
 
-	session, err := (*h).sessionManager.CreateSession("admin")
+	user, err := (*h).userService.Authenticate(req.Username, req.Password)
 	if err != nil {
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			(*h).recordLoginFailure(r, nil, req.Username, "invalid_credentials")
+			if err := (*h).loginLimiter.RecordFailure(client.IP, req.Username); err != nil {
+				http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrUserDisabled):
+			(*h).recordLoginFailure(r, nil, req.Username, "disabled")
+			http.Error(w, "Account is disabled", http.StatusForbidden)
+		default:
+			http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	cookie := &http.Cookie{
-		Name:     "session_id",
-		Value:    session.ID,
-		Path:     "/",
-		Expires:  session.ExpiresAt,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+	if user.TOTPEnabled {
+		// the password is right, but the session is only issued by
+		// LoginSecondFactor once the TOTP or recovery code checks out
+		requireSecondFactor(w, (*h).userService, user, req.RememberMe)
+		return
 	}
-	http.SetCookie(w, cookie)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":    "Login successful",
-		"expires_at": session.ExpiresAt,
-	})
+	if err := (*h).loginLimiter.RecordSuccess(req.Username); err != nil {
+		http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).startSession(w, r, user, req.RememberMe, "password")
 }
 
+// Logout ends the current session. Like other session requests it needs the
+// CSRF token, so other sites cannot log users out.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_id")
-	if err == nil {
-		h.sessionManager.DeleteSession(cookie.Value)
-	}
+	session, _ := auth.GetSessionFromContext(r.Context())
 
-	clearCookie := &http.Cookie{
-		Name:     "session_id",
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+	if err := (*h).sessionManager.DeleteSession(session.ID); err != nil {
+		http.Error(w, "Failed to end session", http.StatusInternalServerError)
+		return
 	}
-	http.SetCookie(w, clearCookie)
+	(*h).sessionManager.ClearSessionCookie(w)
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditLogout,
+		TargetType: "session",
+		TargetID:   session.Handle(),
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -89,16 +140,7 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Status(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"authenticated": false,
-		})
-		return
-	}
-
-	session, exists := (*h).sessionManager.GetSession(cookie.Value)
+	session, exists := (*h).sessionManager.SessionFromRequest(w, r)
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -114,3 +156,168 @@ func (h *AuthHandler) Status(w http.ResponseWriter, r *http.Request) {
 		"expires_at":    session.ExpiresAt,
 	})
 }
+
+// CSRFToken returns the token SPA clients must send in the X-CSRF-Token
+// header with every POST, PUT and DELETE request.
+func (h *AuthHandler) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	session, _ := auth.GetSessionFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"csrf_token": (*h).sessionManager.CSRFToken(session),
+	})
+}
+
+// -- sessions --
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+	current, _ := auth.GetSessionFromContext(r.Context())
+
+	sessions, err := (*h).sessionManager.ListUserSessions(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSessionResponses(sessions, current))
+}
+
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+	current, _ := auth.GetSessionFromContext(r.Context())
+
+	session, exists := (*h).sessionManager.FindUserSession(user.ID, mux.Vars(r)["session"])
+	if !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := (*h).sessionManager.DeleteSession(session.ID); err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if session.ID == current.ID {
+		(*h).sessionManager.ClearSessionCookie(w)
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditSessionsRevoked,
+		TargetType: "session",
+		TargetID:   session.Handle(),
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *AuthHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+	current, _ := auth.GetSessionFromContext(r.Context())
+
+	if err := (*h).sessionManager.DeleteOtherUserSessions(user.ID, current.ID); err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditSessionsRevoked,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(user.ID),
+		After:      map[string]any{"kept_session": current.Handle()},
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// -- helpers --
+
+// startSession logs the user in and writes the login response, method says
+// how the user proved their identity.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *domain.User, remember bool, method string) {
+	session, err := (*h).sessionManager.CreateSession(user.ID, auth.ClientInfoFromRequest(r), remember)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditLogin,
+		Actor:      user,
+		TargetType: "session",
+		TargetID:   session.Handle(),
+		After:      map[string]any{"method": method, "remember": remember},
+	})
+
+	(*h).sessionManager.SetSessionCookie(w, session)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Login successful",
+		"user":       user,
+		"expires_at": session.ExpiresAt,
+		"csrf_token": (*h).sessionManager.CSRFToken(session),
+	})
+}
+
+// requireSecondFactor answers a successful first login step with a pre-auth
+// token for LoginSecondFactor.
+func requireSecondFactor(w http.ResponseWriter, userService *service.UserService, user *domain.User, remember bool) {
+	token, expiresAt, err := (*userService).StartSecondFactor(user.ID, remember)
+	if err != nil {
+		http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":             "Two-factor authentication required",
+		"two_factor_required": true,
+		"pre_auth_token":      token,
+		"expires_at":          expiresAt,
+	})
+}
+
+// recordLoginFailure audits a failed login, user is nil when the attempted
+// username did not get as far as identifying an account.
+func (h *AuthHandler) recordLoginFailure(r *http.Request, user *domain.User, username, reason string) {
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:    service.AuditLoginFailed,
+		Actor:     user,
+		ActorName: username,
+		After:     map[string]any{"reason": reason},
+	})
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
+
+// newSessionResponses hides the session IDs, which are bearer secrets, behind
+// their handles.
+func newSessionResponses(sessions []*auth.Session, current *auth.Session) []sessionResponse {
+	responses := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, sessionResponse{
+			ID:         session.Handle(),
+			CreatedAt:  session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+			LastSeenAt: session.LastSeenAt,
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			Current:    current != nil && session.ID == current.ID,
+		})
+	}
+	return responses
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"blog-system/internal/domain"
+)
+
+func TestCredentialRoutesRejectAPITokens(t *testing.T) {
+	s := newTestServer(t)
+	admin := (*s).createUser(t, "admin", domain.RoleAdmin)
+	session := (*s).createSession(t, admin)
+	token := (*s).createToken(t, admin, "articles:write", "users:manage")
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/api/auth/logout"},
+		{"GET", "/api/auth/csrf"},
+		{"GET", "/api/auth/sessions"},
+		{"DELETE", "/api/auth/sessions"},
+		{"DELETE", "/api/auth/sessions/" + session.Handle()},
+		{"POST", "/api/auth/2fa/setup"},
+		{"POST", "/api/auth/2fa/enable"},
+		{"POST", "/api/auth/2fa/disable"},
+		{"POST", "/api/auth/2fa/recovery-codes"},
+		{"GET", "/api/auth/tokens"},
+		{"POST", "/api/auth/password"},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			r := httptest.NewRequest(route.method, route.path, strings.NewReader("{}"))
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			w := (*s).serve(r)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+			}
+		})
+	}
+
+	if _, exists := (*s).sessionManager.GetSession(session.ID); !exists {
+		t.Fatal("session was revoked through an API token")
+	}
+}
+
+func TestRevokeUserSessionsWithAPIToken(t *testing.T) {
+	s := newTestServer(t)
+	admin := (*s).createUser(t, "admin", domain.RoleAdmin)
+	author := (*s).createUser(t, "author", domain.RoleAuthor)
+	token := (*s).createToken(t, admin, "articles:write", "users:manage")
+
+	for _, user := range []*domain.User{admin, author} {
+		t.Run(user.Username, func(t *testing.T) {
+			first := (*s).createSession(t, user)
+			second := (*s).createSession(t, user)
+
+			r := httptest.NewRequest("DELETE", fmt.Sprintf("/api/admin/users/%d/sessions", user.ID), nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			w := (*s).serve(r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			for _, session := range []string{first.ID, second.ID} {
+				if _, exists := (*s).sessionManager.GetSession(session); exists {
+					t.Errorf("session %s survived", session[:8])
+				}
+			}
+		})
+	}
+}
+
+func TestLoginThrottling(t *testing.T) {
+	s := newTestServer(t)
+	(*s).createUser(t, "jane", domain.RoleAuthor)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"username": "jane", "password": %q}`, password)
+		return (*s).serve(httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(body)))
+	}
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		if w := login("wrong password"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", attempt, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// locked out even with the right password
+	w := login("correct horse battery")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusTooManyRequests, w.Body)
+	}
+	if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 30 {
+		t.Errorf("Retry-After = %q, want up to 30 seconds", w.Header().Get("Retry-After"))
+	}
+}
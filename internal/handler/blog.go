@@ -1,16 +1,29 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"blog-system/internal/auth"
+	"blog-system/internal/domain"
 	"blog-system/internal/service"
 
 	"github.com/gorilla/mux"
 )
 
+const (
+	defaultArticlePageSize = 20
+	maxArticlePageSize     = 100
+)
+
 type BlogHandler struct {
 	service *service.BlogService
 }
@@ -19,33 +32,80 @@ func NewBlogHandler(service *service.BlogService) *BlogHandler {
 	return &BlogHandler{service: service}
 }
 
-func (h *BlogHandler) RegisterRoutes(r *mux.Router, sessionManager *auth.SessionManager) {
+// RegisterRoutes takes identify to recognize staff on the public routes, who
+// can also read drafts.
+func (h *BlogHandler) RegisterRoutes(r *mux.Router, protect, identify mux.MiddlewareFunc) {
+	public := (*r).PathPrefix("").Subrouter()
+	(*public).Use(identify)
+
 	protected := (*r).PathPrefix("").Subrouter()
-	(*protected).Use(auth.AuthMiddleware(sessionManager))
+	(*protected).Use(protect)
+
+	writers := (*protected).PathPrefix("").Subrouter()
+	(*writers).Use(auth.RequirePermission(auth.PermWriteArticles))
+
+	editors := (*protected).PathPrefix("").Subrouter()
+	(*editors).Use(auth.RequirePermission(auth.PermEditAnyArticle))
+
+	moderators := (*protected).PathPrefix("").Subrouter()
+	(*moderators).Use(auth.RequirePermission(auth.PermModerateComments))
 
 	articleStemPath := "/articles"
 	articleSpecificPath := articleStemPath + "/{id:[0-9]+}"
 
 	// public articles
-	(*r).HandleFunc(articleStemPath, (*h).GetAllArticles).Methods("GET")
-	(*r).HandleFunc(articleSpecificPath, (*h).GetArticle).Methods("GET")
+	(*public).HandleFunc(articleStemPath, (*h).GetAllArticles).Methods("GET")
+	(*public).HandleFunc(articleSpecificPath, (*h).GetArticle).Methods("GET")
+	(*public).HandleFunc(articleStemPath+"/by-slug/{slug}", (*h).GetArticleBySlug).Methods("GET")
+	(*public).HandleFunc("/search", (*h).Search).Methods("GET")
 
 	// public comments
 	(*r).HandleFunc(articleSpecificPath+"/comments", (*h).AddComment).Methods("POST")
 
 	// protected articles
-	(*protected).HandleFunc(articleStemPath, (*h).CreateArticle).Methods("POST")
-	(*protected).HandleFunc(articleSpecificPath, (*h).UpdateArticle).Methods("PUT")
-	(*protected).HandleFunc(articleSpecificPath, (*h).DeleteArticle).Methods("DELETE")
+	(*writers).HandleFunc(articleStemPath, (*h).CreateArticle).Methods("POST")
+	(*writers).HandleFunc(articleSpecificPath, (*h).UpdateArticle).Methods("PUT")
+	(*writers).HandleFunc(articleSpecificPath, (*h).DeleteArticle).Methods("DELETE")
+	(*writers).HandleFunc(articleSpecificPath+"/publish", (*h).PublishArticle).Methods("POST")
+	(*writers).HandleFunc(articleSpecificPath+"/unpublish", (*h).UnpublishArticle).Methods("POST")
+	(*writers).HandleFunc(articleSpecificPath+"/archive", (*h).ArchiveArticle).Methods("POST")
+	(*writers).HandleFunc(articleSpecificPath+"/schedule", (*h).ScheduleArticle).Methods("PUT")
+	(*writers).HandleFunc(articleSpecificPath+"/slug", (*h).SetSlug).Methods("PUT")
+	(*writers).HandleFunc(articleStemPath+"/schedule", (*h).GetUpcomingSchedule).Methods("GET")
+
+	// protected revisions
+	revisionsPath := articleSpecificPath + "/revisions"
+	(*writers).HandleFunc(revisionsPath, (*h).GetRevisions).Methods("GET")
+	(*writers).HandleFunc(revisionsPath+"/diff", (*h).DiffRevisions).Methods("GET")
+	(*writers).HandleFunc(revisionsPath+"/{revision:[0-9]+}", (*h).GetRevision).Methods("GET")
+	(*writers).HandleFunc(revisionsPath+"/{revision:[0-9]+}/restore", (*h).RestoreRevision).Methods("POST")
+
+	// article tags
+	(*writers).HandleFunc(articleSpecificPath+"/tags", (*h).AddArticleTags).Methods("POST")
+	(*writers).HandleFunc(articleSpecificPath+"/tags", (*h).SetArticleTags).Methods("PUT")
+	(*writers).HandleFunc(articleSpecificPath+"/tags/{tag_id:[0-9]+}", (*h).RemoveArticleTag).Methods("DELETE")
+
+	// tags, changing existing ones affects everyone's articles
+	tagStemPath := "/tags"
+	tagSpecificPath := tagStemPath + "/{id:[0-9]+}"
+	(*public).HandleFunc(tagStemPath, (*h).GetTags).Methods("GET")
+	(*writers).HandleFunc(tagStemPath, (*h).CreateTag).Methods("POST")
+	(*editors).HandleFunc(tagSpecificPath, (*h).RenameTag).Methods("PUT")
+	(*editors).HandleFunc(tagSpecificPath+"/merge", (*h).MergeTag).Methods("POST")
+	(*editors).HandleFunc(tagSpecificPath, (*h).DeleteTag).Methods("DELETE")
+
+	// protected comments
+	(*moderators).HandleFunc("/comments/{id:[0-9]+}", (*h).DeleteComment).Methods("DELETE")
 }
 
 // -- articles --
 func (h *BlogHandler) CreateArticle(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Title   string   `json:"title"`
-		Content string   `json:"content"`
-		Author  string   `json:"author"`
-		Tags    []string `json:"tags"`
+		Title   string               `json:"title"`
+		Content string               `json:"content"`
+		Author  string               `json:"author"`
+		Tags    []string             `json:"tags"`
+		Status  domain.ArticleStatus `json:"status"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -54,17 +114,19 @@ func (h *BlogHandler) CreateArticle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	article, err := (*h).service.CreateArticle(
+		r.Context(),
 		req.Title,
 		req.Content,
 		req.Author,
-		req.Tags)
+		req.Tags,
+		req.Status)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBlogError(w, err)
 		return
 	}
 
-	w.Header().Set("Content/Type", "application/json")
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(article)
 }
@@ -76,9 +138,9 @@ func (h *BlogHandler) GetArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	article, err := (*h).service.GetArticle(id)
+	article, err := (*h).service.GetArticle(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Article not found", http.StatusNotFound)
+		writeBlogError(w, err)
 		return
 	}
 
@@ -86,15 +148,61 @@ func (h *BlogHandler) GetArticle(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(article)
 }
 
+// GetArticleBySlug permanently redirects former slugs to the current one.
+func (h *BlogHandler) GetArticleBySlug(w http.ResponseWriter, r *http.Request) {
+	requested := mux.Vars(r)["slug"]
+
+	article, current, err := (*h).service.GetArticleBySlug(r.Context(), requested)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	if current != "" {
+		location := strings.TrimSuffix(r.URL.Path, requested) + current
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
+
+// GetAllArticles lists published articles, staff can pass status=draft,
+// archived or all. Articles are sorted with sort=created, updated, published
+// (the default) or title and order=asc or desc, and filtered by tag, author,
+// author_id, and since and until as RFC 3339 times or dates. The total count
+// is in X-Total-Count and the next and previous pages of limit articles are
+// linked in the Link header.
 func (h *BlogHandler) GetAllArticles(w http.ResponseWriter, r *http.Request) {
-	articles, err := (*h).service.GetAllArticles()
+	query := r.URL.Query()
+
+	articleQuery, err := parseArticleQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := (*h).service.GetAllArticles(r.Context(), articleQuery, query.Get("cursor"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBlogError(w, err)
 		return
 	}
 
+	var links []string
+	if list.NextCursor != "" {
+		links = append(links, pageLink(r, list.NextCursor, "next"))
+	}
+	if list.PrevCursor != "" {
+		links = append(links, pageLink(r, list.PrevCursor, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(list.Total))
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(articles)
+	json.NewEncoder(w).Encode(list.Articles)
 }
 
 func (h *BlogHandler) UpdateArticle(w http.ResponseWriter, r *http.Request) {
@@ -114,9 +222,9 @@ func (h *BlogHandler) UpdateArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	article, err := (*h).service.UpdateArticle(id, req.Title, req.Content)
+	article, err := (*h).service.UpdateArticle(r.Context(), id, req.Title, req.Content)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBlogError(w, err)
 		return
 	}
 
@@ -131,14 +239,93 @@ func (h *BlogHandler) DeleteArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := (*h).service.DeleteArticle(id); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := (*h).service.DeleteArticle(r.Context(), id); err != nil {
+		writeBlogError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+func (h *BlogHandler) PublishArticle(w http.ResponseWriter, r *http.Request) {
+	(*h).changeStatus(w, r, (*h).service.PublishArticle)
+}
+
+func (h *BlogHandler) UnpublishArticle(w http.ResponseWriter, r *http.Request) {
+	(*h).changeStatus(w, r, (*h).service.UnpublishArticle)
+}
+
+func (h *BlogHandler) ArchiveArticle(w http.ResponseWriter, r *http.Request) {
+	(*h).changeStatus(w, r, (*h).service.ArchiveArticle)
+}
+
+// SetSlug takes {"slug": "..."}, an empty slug is generated from the title.
+func (h *BlogHandler) SetSlug(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Slug string `json:"slug"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	article, err := (*h).service.SetSlug(r.Context(), id, req.Slug)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
+
+// ScheduleArticle takes RFC 3339 publish_at and unpublish_at times, null or
+// missing ones are cleared.
+func (h *BlogHandler) ScheduleArticle(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		PublishAt   *time.Time `json:"publish_at"`
+		UnpublishAt *time.Time `json:"unpublish_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	article, err := (*h).service.ScheduleArticle(r.Context(), id, req.PublishAt, req.UnpublishAt)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
+
+func (h *BlogHandler) GetUpcomingSchedule(w http.ResponseWriter, r *http.Request) {
+	changes, err := (*h).service.GetUpcomingSchedule(r.Context())
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
 // -- comments --
 func (h *BlogHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	articleID, err := (*h).getIDFromPath(r)
@@ -159,7 +346,7 @@ func (h *BlogHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 
 	comment, err := (*h).service.AddComment(articleID, req.Author, req.Content)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBlogError(w, err)
 		return
 	}
 
@@ -168,8 +355,122 @@ func (h *BlogHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(comment)
 }
 
+func (h *BlogHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := (*h).service.DeleteComment(r.Context(), id); err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // -- helpers --
 func (h *BlogHandler) getIDFromPath(r *http.Request) (int, error) {
 	vars := mux.Vars(r)
 	return strconv.Atoi(vars["id"])
 }
+
+func (h *BlogHandler) changeStatus(w http.ResponseWriter, r *http.Request, change func(context.Context, int) (*domain.Article, error)) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	article, err := change(r.Context(), id)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
+
+func parseArticleQuery(query url.Values) (domain.ArticleQuery, error) {
+	articleQuery := domain.ArticleQuery{
+		Status: domain.ArticleStatus(query.Get("status")),
+		Author: query.Get("author"),
+		Tag:    query.Get("tag"),
+		Sort:   domain.ArticleSort(query.Get("sort")),
+	}
+
+	if authorID := query.Get("author_id"); authorID != "" {
+		id, err := strconv.Atoi(authorID)
+		if err != nil {
+			return articleQuery, fmt.Errorf("invalid author_id")
+		}
+		articleQuery.AuthorID = id
+	}
+
+	// titles read best from A to Z, dates newest first
+	switch query.Get("order") {
+	case "":
+		articleQuery.Ascending = articleQuery.Sort == domain.SortTitle
+	case "asc":
+		articleQuery.Ascending = true
+	case "desc":
+	default:
+		return articleQuery, fmt.Errorf("order must be asc or desc")
+	}
+
+	var err error
+	if articleQuery.Since, err = parseQueryTime(query, "since"); err != nil {
+		return articleQuery, err
+	}
+	if articleQuery.Until, err = parseQueryTime(query, "until"); err != nil {
+		return articleQuery, err
+	}
+
+	limit, err := positiveQueryInt(query, "limit", defaultArticlePageSize)
+	if err != nil {
+		return articleQuery, err
+	}
+	articleQuery.Limit = min(limit, maxArticlePageSize)
+
+	return articleQuery, nil
+}
+
+// pageLink is a Link header entry for the current URL with another cursor.
+func pageLink(r *http.Request, cursor, rel string) string {
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel)
+}
+
+func writeBlogError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrArticleNotFound):
+		http.Error(w, "Article not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrCommentNotFound):
+		http.Error(w, "Comment not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrRevisionNotFound):
+		http.Error(w, "Revision not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrTagNotFound):
+		http.Error(w, "Tag not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, service.ErrSlugTaken), errors.Is(err, service.ErrTagExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrSearchUnavailable):
+		http.Error(w, "Search is not available on this server", http.StatusNotImplemented)
+	case errors.Is(err, service.ErrInvalidArticle), errors.Is(err, service.ErrInvalidComment),
+		errors.Is(err, service.ErrInvalidArticleStatus), errors.Is(err, service.ErrInvalidSchedule),
+		errors.Is(err, service.ErrInvalidSort), errors.Is(err, service.ErrInvalidCursor),
+		errors.Is(err, service.ErrInvalidSlug), errors.Is(err, service.ErrInvalidTag),
+		errors.Is(err, service.ErrMergeSameTags), errors.Is(err, service.ErrInvalidSearch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrDiffTooLarge):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		// repository and database errors are not for clients to see
+		log.Println("Blog request failed:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"blog-system/internal/domain"
+)
+
+func TestCreateArticleSkipsBlankTags(t *testing.T) {
+	s := newTestServer(t)
+	author := (*s).createUser(t, "jane", domain.RoleAuthor)
+	token := (*s).createToken(t, author, "articles:write")
+
+	r := httptest.NewRequest("POST", "/api/articles", strings.NewReader(`{"title": "Hello", "content": "World", "tags": ["go", "", "  "]}`))
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	w := (*s).serve(r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+
+	var article domain.Article
+	if err := json.NewDecoder(w.Body).Decode(&article); err != nil {
+		t.Fatal(err)
+	}
+	if len(article.Tags) != 1 || article.Tags[0].Name != "go" {
+		t.Errorf("tags = %v, want [go]", article.Tags)
+	}
+}
+
+func TestCreateArticleRollsBackWhenTagsFail(t *testing.T) {
+	s := newTestServer(t)
+	author := (*s).createUser(t, "jane", domain.RoleAuthor)
+	token := (*s).createToken(t, author, "articles:write")
+
+	// saving the second tag fails after the article and first tag were written
+	_, err := (*s).db.Exec(`CREATE TRIGGER fail_tag BEFORE INSERT ON tags WHEN NEW.name = 'broken'
+		BEGIN SELECT RAISE(ABORT, 'cannot save tag'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/api/articles", strings.NewReader(`{"title": "Hello", "content": "World", "tags": ["go", "broken"]}`))
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	w := (*s).serve(r)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "cannot save tag") {
+		t.Errorf("database error sent to the client: %s", w.Body)
+	}
+
+	for _, table := range []string{"articles", "article_tags", "article_revisions", "tags"} {
+		var count int
+		if err := (*s).db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%d %s rows were kept", count, table)
+		}
+	}
+}
+
+func TestCreateArticleValidation(t *testing.T) {
+	s := newTestServer(t)
+	author := (*s).createUser(t, "jane", domain.RoleAuthor)
+	token := (*s).createToken(t, author, "articles:write")
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "empty title", body: `{"title": " ", "content": "World"}`},
+		{name: "empty content", body: `{"title": "Hello", "content": ""}`},
+		{name: "archived", body: `{"title": "Hello", "content": "World", "status": "archived"}`},
+		{name: "long tag", body: `{"title": "Hello", "content": "World", "tags": ["` + strings.Repeat("x", 100) + `"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/articles", strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			if w := (*s).serve(r); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+		})
+	}
+}
+
+func TestListArticlesPages(t *testing.T) {
+	s := newTestServer(t)
+	author := (*s).createUser(t, "jane", domain.RoleAuthor)
+	token := (*s).createToken(t, author, "articles:write")
+
+	// published within the same second, so only the ids order them
+	for i := range 5 {
+		(*s).createArticle(t, token, fmt.Sprintf(`{"title": "Article %d", "content": "Content", "status": "published"}`, i))
+	}
+
+	// get returns the titles on the page and its Link header relations
+	get := func(path string) ([]string, map[string]string) {
+		t.Helper()
+		w := (*s).serve((*s).tokenRequest("", "GET", path, ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", path, w.Code, http.StatusOK, w.Body)
+		}
+		if total := w.Header().Get("X-Total-Count"); total != "5" {
+			t.Errorf("%s: X-Total-Count = %q, want 5", path, total)
+		}
+
+		var articles []domain.Article
+		if err := json.NewDecoder(w.Body).Decode(&articles); err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, article := range articles {
+			titles = append(titles, article.Title)
+		}
+
+		links := map[string]string{}
+		for _, match := range linkPattern.FindAllStringSubmatch(w.Header().Get("Link"), -1) {
+			links[match[2]] = match[1]
+		}
+		return titles, links
+	}
+
+	tests := []struct {
+		follow string
+		titles string
+		rels   string
+	}{
+		{follow: "", titles: "Article 4,Article 3", rels: "next"},
+		{follow: "next", titles: "Article 2,Article 1", rels: "next,prev"},
+		{follow: "next", titles: "Article 0", rels: "prev"},
+		{follow: "prev", titles: "Article 2,Article 1", rels: "next,prev"},
+		{follow: "prev", titles: "Article 4,Article 3", rels: "next"},
+	}
+
+	path := "/api/articles?limit=2"
+	var links map[string]string
+	for i, tt := range tests {
+		if tt.follow != "" {
+			path = links[tt.follow]
+		}
+
+		var titles []string
+		titles, links = get(path)
+		rels := slices.Sorted(maps.Keys(links))
+		if strings.Join(titles, ",") != tt.titles || strings.Join(rels, ",") != tt.rels {
+			t.Fatalf("page %d: %v linking %v, want %s linking %s", i+1, titles, rels, tt.titles, tt.rels)
+		}
+		for rel, link := range links {
+			if linked, err := url.Parse(link); err != nil || linked.Query().Get("limit") != "2" {
+				t.Errorf("page %d: %s link %q does not keep the limit", i+1, rel, link)
+			}
+		}
+	}
+
+	// a cursor from one order cannot be used for another
+	query, _ := url.Parse(links["next"])
+	cursor := query.Query().Get("cursor")
+	w := (*s).serve((*s).tokenRequest("", "GET", "/api/articles?sort=title&cursor="+url.QueryEscape(cursor), ""))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("cursor for another sort: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+var linkPattern = regexp.MustCompile(`<([^>]*)>; rel="(\w+)"`)
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"blog-system/internal/service"
+)
+
+// RequestMagicLink emails a single-use login link. The response is the same
+// whether or not the address belongs to an account.
+func (h *AuthHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		http.Error(w, "email field cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := (*h).magicLinkService.SendLink(req.Email); err != nil {
+		log.Println("Sending login link failed:", err)
+		http.Error(w, "Failed to send login link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the address belongs to an account, a login link has been sent",
+	})
+}
+
+// VerifyMagicLink redeems the token from the emailed link. Like Login, it
+// asks for the second factor when the user has enabled one.
+func (h *AuthHandler) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token      string `json:"token"`
+		RememberMe bool   `json:"remember_me"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	user, err := (*h).magicLinkService.Redeem(req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMagicLink):
+			(*h).recordLoginFailure(r, nil, "", "invalid_magic_link")
+			http.Error(w, "Invalid or expired login link", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrUserDisabled):
+			http.Error(w, "Account is disabled", http.StatusForbidden)
+		default:
+			http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if user.TOTPEnabled {
+		requireSecondFactor(w, (*h).userService, user, req.RememberMe)
+		return
+	}
+
+	(*h).startSession(w, r, user, req.RememberMe, "magic_link")
+}
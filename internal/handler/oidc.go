@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// OIDCHandler logs users in through an OpenID Connect provider as an
+// alternative to AuthHandler.Login.
+type OIDCHandler struct {
+	provider          *auth.OIDCProvider
+	ssoService        *service.SSOService
+	userService       *service.UserService
+	sessionManager    *auth.SessionManager
+	postLoginRedirect string
+	audit             *service.AuditLogger
+}
+
+func NewOIDCHandler(provider *auth.OIDCProvider, ssoService *service.SSOService, userService *service.UserService, sessionManager *auth.SessionManager, postLoginRedirect string, audit *service.AuditLogger) *OIDCHandler {
+	return &OIDCHandler{
+		provider:          provider,
+		ssoService:        ssoService,
+		userService:       userService,
+		sessionManager:    sessionManager,
+		postLoginRedirect: postLoginRedirect,
+		audit:             audit,
+	}
+}
+
+func (h *OIDCHandler) RegisterRoutes(r *mux.Router) {
+	(*r).HandleFunc("/auth/oidc/login", (*h).Login).Methods("GET")
+	(*r).HandleFunc("/auth/oidc/callback", (*h).Callback).Methods("GET")
+}
+
+// Login redirects the browser to the provider. Pass ?remember_me=true for a
+// long-lived session.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	state, challenge, err := auth.NewOIDCLoginState(r.URL.Query().Get("remember_me") == "true")
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	redirect, err := (*h).provider.AuthCodeURL(r.Context(), state.State, state.Nonce, challenge)
+	if err != nil {
+		log.Println("OIDC login failed:", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	(*h).sessionManager.SetOIDCStateCookie(w, state)
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// Callback is where the provider sends the browser back to after login.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	state, exists := (*h).sessionManager.OIDCStateFromRequest(w, r)
+	if !exists || subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	if providerError := query.Get("error"); providerError != "" {
+		http.Error(w, "Login failed at the identity provider: "+providerError, http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := (*h).provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Println("OIDC code exchange failed:", err)
+		http.Error(w, "Failed to verify login with the identity provider", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := (*h).ssoService.LoginWithOIDC(r.Context(), claims)
+	if err != nil {
+		(*h).audit.Record(r.Context(), service.AuditEntry{
+			Action:    service.AuditLoginFailed,
+			ActorName: claims.Email,
+			After:     map[string]any{"reason": err.Error(), "method": "oidc", "subject": claims.Subject},
+		})
+
+		switch {
+		case errors.Is(err, service.ErrSSONotAllowed):
+			http.Error(w, "Your account is not allowed to log in here", http.StatusForbidden)
+		case errors.Is(err, service.ErrUserDisabled):
+			http.Error(w, "Account is disabled", http.StatusForbidden)
+		default:
+			http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// the identity provider stands in for the password, not the second factor
+	if user.TOTPEnabled {
+		requireSecondFactor(w, (*h).userService, user, state.Remember)
+		return
+	}
+
+	session, err := (*h).sessionManager.CreateSession(user.ID, auth.ClientInfoFromRequest(r), state.Remember)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditLogin,
+		Actor:      user,
+		TargetType: "session",
+		TargetID:   session.Handle(),
+		After:      map[string]any{"method": "oidc", "remember": state.Remember},
+	})
+
+	(*h).sessionManager.SetSessionCookie(w, session)
+	http.Redirect(w, r, (*h).postLoginRedirect, http.StatusFound)
+}
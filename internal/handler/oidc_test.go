@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/auth/oidctest"
+	"blog-system/internal/domain"
+	"blog-system/internal/service"
+)
+
+const oidcRedirectURL = "http://blog.test/api/auth/oidc/callback"
+
+// withOIDC registers single sign-on against a stand-in provider, mapping
+// its blog-admins group to admins and everyone else to authors.
+func (s *testServer) withOIDC(t *testing.T) *oidctest.Provider {
+	t.Helper()
+
+	idp := oidctest.NewProvider("blog")
+	t.Cleanup(idp.Close)
+
+	provider := auth.NewOIDCProvider(auth.OIDCConfig{
+		IssuerURL:   idp.URL(),
+		ClientID:    "blog",
+		RedirectURL: oidcRedirectURL,
+	}, nil)
+	mapping := service.SSORoleMapping{
+		GroupRoles:  map[string]domain.Role{"blog-admins": domain.RoleAdmin},
+		DefaultRole: domain.RoleAuthor,
+	}
+	ssoService := service.NewSSOService((*s).repo, mapping, (*s).audit)
+
+	api := (*s).router.PathPrefix("/api").Subrouter()
+	NewOIDCHandler(provider, ssoService, (*s).userService, (*s).sessionManager, "/", (*s).audit).RegisterRoutes(api)
+	return idp
+}
+
+// oidcLogin runs the browser's side of the login and returns the callback's
+// response.
+func (s *testServer) oidcLogin(t *testing.T, idp *oidctest.Provider, login oidctest.Login) *httptest.ResponseRecorder {
+	t.Helper()
+	idp.SetLogin(login)
+
+	start := (*s).serve(httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", start.Code, start.Body)
+	}
+
+	callback, err := idp.Authorize(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.String() != oidcRedirectURL+"?"+callback.RawQuery {
+		t.Fatalf("provider redirected to %s", callback)
+	}
+
+	r := httptest.NewRequest("GET", callback.RequestURI(), nil)
+	for _, cookie := range start.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	return (*s).serve(r)
+}
+
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == auth.SessionCookieName && cookie.Value != "" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	s := newTestServer(t)
+	idp := (*s).withOIDC(t)
+
+	w := (*s).oidcLogin(t, idp, oidctest.Login{Claims: map[string]any{
+		"sub":                "jane-id",
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"preferred_username": "jane",
+		"groups":             []string{"staff"},
+	}})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Fatalf("callback status = %d, location %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	if sessionCookie(w) == nil {
+		t.Fatal("callback set no session cookie")
+	}
+
+	user, err := (*s).repo.GetUserByOIDCSubject("jane-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "jane" || user.Role != domain.RoleAuthor || !user.SSOManaged {
+		t.Errorf("user = %+v, want SSO managed author jane", user)
+	}
+}
+
+func TestOIDCLoginRejectsInvalidToken(t *testing.T) {
+	s := newTestServer(t)
+	idp := (*s).withOIDC(t)
+
+	w := (*s).oidcLogin(t, idp, oidctest.Login{CorruptSignature: true})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("callback status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if sessionCookie(w) != nil {
+		t.Fatal("callback set a session cookie")
+	}
+}
+
+func TestOIDCLoginRoles(t *testing.T) {
+	s := newTestServer(t)
+	idp := (*s).withOIDC(t)
+
+	admin := (*s).createUser(t, "admin", domain.RoleAdmin)
+	if _, err := (*s).userService.SetUserEmail(admin.ID, "admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// linked local accounts keep their role without any groups
+	w := (*s).oidcLogin(t, idp, oidctest.Login{Claims: map[string]any{
+		"sub":            "admin-id",
+		"email":          "admin@example.com",
+		"email_verified": true,
+	}})
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback status = %d: %s", w.Code, w.Body)
+	}
+	if user, _ := (*s).repo.GetUser(admin.ID); user.Role != domain.RoleAdmin || user.OIDCSubject != "admin-id" {
+		t.Errorf("linked admin = %+v, want admin linked to admin-id", user)
+	}
+
+	// accounts created through SSO follow their groups
+	login := oidctest.Login{Claims: map[string]any{"sub": "jane-id", "preferred_username": "jane", "groups": []string{"blog-admins"}}}
+	(*s).oidcLogin(t, idp, login)
+	login.Claims["groups"] = nil
+	(*s).oidcLogin(t, idp, login)
+
+	jane, err := (*s).repo.GetUserByOIDCSubject("jane-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jane.Role != domain.RoleAuthor {
+		t.Errorf("role = %q, want %q after leaving blog-admins", jane.Role, domain.RoleAuthor)
+	}
+
+	events, err := (*s).repo.GetAuditEvents(domain.AuditFilter{Action: service.AuditUserRoleChanged})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].TargetID != strconv.Itoa(jane.ID) || events[0].ActorName != service.SSOActor {
+		t.Errorf("role change events = %+v, want one for jane by %q", events, service.SSOActor)
+	}
+}
+
+func TestOIDCLoginRequiresSecondFactor(t *testing.T) {
+	s := newTestServer(t)
+	idp := (*s).withOIDC(t)
+
+	user := (*s).createUser(t, "jane", domain.RoleEditor)
+	if _, err := (*s).userService.SetUserEmail(user.ID, "jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	secret, _, err := (*s).userService.BeginTOTPEnrollment(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	if _, err := (*s).userService.ConfirmTOTPEnrollment(user.ID, code); err != nil {
+		t.Fatal(err)
+	}
+
+	w := (*s).oidcLogin(t, idp, oidctest.Login{Claims: map[string]any{
+		"sub":            "jane-id",
+		"email":          "jane@example.com",
+		"email_verified": true,
+	}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d: %s", w.Code, w.Body)
+	}
+	if sessionCookie(w) != nil {
+		t.Fatal("callback logged in without the second factor")
+	}
+
+	var response struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		PreAuthToken      string `json:"pre_auth_token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.TwoFactorRequired || response.PreAuthToken == "" {
+		t.Fatalf("response = %+v, want a pre-auth token", response)
+	}
+	if userID, _, ok := (*s).sessionManager.VerifyPreAuthToken(response.PreAuthToken); !ok || userID != user.ID {
+		t.Errorf("pre-auth token is for user %d, want %d", userID, user.ID)
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+type PasswordHandler struct {
+	userService    *service.UserService
+	resetService   *service.PasswordResetService
+	sessionManager *auth.SessionManager
+	loginLimiter   *auth.LoginLimiter
+	audit          *service.AuditLogger
+}
+
+func NewPasswordHandler(userService *service.UserService, resetService *service.PasswordResetService, sessionManager *auth.SessionManager, loginLimiter *auth.LoginLimiter, audit *service.AuditLogger) *PasswordHandler {
+	return &PasswordHandler{
+		userService:    userService,
+		resetService:   resetService,
+		sessionManager: sessionManager,
+		loginLimiter:   loginLimiter,
+		audit:          audit,
+	}
+}
+
+func (h *PasswordHandler) RegisterRoutes(r *mux.Router, protect mux.MiddlewareFunc) {
+	protected := (*r).PathPrefix("/auth/password").Subrouter()
+	(*protected).Use(protect)
+	(*protected).Use(requireSession)
+
+	(*protected).HandleFunc("", (*h).ChangePassword).Methods("POST")
+	(*r).HandleFunc("/auth/password/forgot", (*h).ForgotPassword).Methods("POST")
+	(*r).HandleFunc("/auth/password/reset", (*h).ResetPassword).Methods("POST")
+}
+
+// ChangePassword sets a new password and logs out every other session of the
+// user.
+func (h *PasswordHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+	session, _ := auth.GetSessionFromContext(r.Context())
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// a hijacked session must not be able to guess the current password
+	client := auth.ClientInfoFromRequest(r)
+	retryAfter, err := (*h).loginLimiter.Check(client.IP, user.Username)
+	if err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyAttempts(w, retryAfter)
+		return
+	}
+
+	if err := (*h).userService.ChangePassword(user.ID, req.CurrentPassword, req.NewPassword); err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			if err := (*h).loginLimiter.RecordFailure(client.IP, user.Username); err != nil {
+				http.Error(w, "Failed to change password", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Current password is incorrect", http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := (*h).sessionManager.DeleteOtherUserSessions(user.ID, session.ID); err != nil {
+		http.Error(w, "Password changed, but failed to revoke other sessions", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditPasswordChanged,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(user.ID),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password changed",
+	})
+}
+
+// ForgotPassword emails a reset link. The response is the same whether or not
+// the address belongs to an account.
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		http.Error(w, "email field cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := (*h).resetService.RequestReset(req.Email); err != nil {
+		log.Println("Sending password reset link failed:", err)
+		http.Error(w, "Failed to send password reset link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the address belongs to an account, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password with the token from the emailed link and
+// logs out every session of the user.
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	user, err := (*h).resetService.ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidResetToken):
+			http.Error(w, "Invalid or expired password reset link", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrUserDisabled):
+			http.Error(w, "Account is disabled", http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := (*h).sessionManager.DeleteUserSessions(user.ID); err != nil {
+		http.Error(w, "Password reset, but failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditPasswordReset,
+		Actor:      user,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(user.ID),
+	})
+	// whoever locked the account out by guessing is locked out by the new
+	// password now
+	if err := (*h).loginLimiter.RecordSuccess(user.Username); err != nil {
+		log.Println("Clearing login failures failed:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password reset, please log in with the new password",
+	})
+}
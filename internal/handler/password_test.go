@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blog-system/internal/domain"
+)
+
+// login tries the password and reports whether it was accepted.
+func (s *testServer) login(username, password string) bool {
+	body := fmt.Sprintf(`{"username": %q, "password": %q}`, username, password)
+	w := (*s).serve(httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(body)))
+	return w.Code == http.StatusOK
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	user := (*s).createUser(t, "jane", domain.RoleAuthor)
+	current := (*s).createSession(t, user)
+	other := (*s).createSession(t, user)
+
+	w := (*s).serve((*s).sessionRequest(current, "POST", "/api/auth/password", `{"current_password": "wrong", "new_password": "a new password"}`))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("wrong current password: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = (*s).serve((*s).sessionRequest(current, "POST", "/api/auth/password", `{"current_password": "correct horse battery", "new_password": "short"}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("too short password: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = (*s).serve((*s).sessionRequest(current, "POST", "/api/auth/password", `{"current_password": "correct horse battery", "new_password": "a new password"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	if _, exists := (*s).sessionManager.GetSession(current.ID); !exists {
+		t.Error("the session the password was changed with was revoked")
+	}
+	if _, exists := (*s).sessionManager.GetSession(other.ID); exists {
+		t.Error("other session survived the password change")
+	}
+	if (*s).login("jane", "correct horse battery") {
+		t.Error("old password still works")
+	}
+	if !(*s).login("jane", "a new password") {
+		t.Error("new password does not work")
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	s := newTestServer(t)
+	user, err := (*s).userService.CreateUser("jane", "jane@example.com", "correct horse battery", domain.RoleAuthor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := (*s).createSession(t, user)
+
+	forgot := func(email string) {
+		t.Helper()
+		w := (*s).serve(httptest.NewRequest("POST", "/api/auth/password/forgot", strings.NewReader(`{"email": "`+email+`"}`)))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("forgot: status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+		}
+	}
+	reset := func(token, password string) int {
+		body := fmt.Sprintf(`{"token": %q, "new_password": %q}`, token, password)
+		return (*s).serve(httptest.NewRequest("POST", "/api/auth/password/reset", strings.NewReader(body))).Code
+	}
+
+	// unknown addresses get the same answer but no mail
+	forgot("nobody@example.com")
+	if messages := (*s).mail.Messages(); len(messages) != 0 {
+		t.Fatalf("%d mails sent for an unknown address", len(messages))
+	}
+
+	forgot("jane@example.com")
+	earlier := (*s).mailedToken(t, "jane@example.com")
+	forgot("JANE@example.com")
+	token := (*s).mailedToken(t, "jane@example.com")
+
+	// a rejected password does not use up the token
+	if code := reset(token, "short"); code != http.StatusBadRequest {
+		t.Errorf("too short password: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := reset(token, "a new password"); code != http.StatusOK {
+		t.Fatalf("reset: status = %d, want %d", code, http.StatusOK)
+	}
+
+	if _, exists := (*s).sessionManager.GetSession(session.ID); exists {
+		t.Error("session survived the password reset")
+	}
+	if (*s).login("jane", "correct horse battery") {
+		t.Error("old password still works")
+	}
+	if !(*s).login("jane", "a new password") {
+		t.Error("new password does not work")
+	}
+
+	// the link is single use, and the reset invalidates the other links sent
+	for name, used := range map[string]string{"same link": token, "earlier link": earlier, "forged link": "forged"} {
+		if code := reset(used, "another password"); code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d", name, code, http.StatusUnauthorized)
+		}
+	}
+}
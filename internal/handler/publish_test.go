@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"blog-system/internal/domain"
+)
+
+// createArticle posts the JSON body to /api/articles with the token.
+func (s *testServer) createArticle(t *testing.T, token, body string) *domain.Article {
+	t.Helper()
+
+	w := (*s).serve((*s).tokenRequest(token, "POST", "/api/articles", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create article: status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+
+	var article domain.Article
+	if err := json.NewDecoder(w.Body).Decode(&article); err != nil {
+		t.Fatal(err)
+	}
+	return &article
+}
+
+// listArticles returns the titles listed by GET /api/articles?query.
+func (s *testServer) listArticles(t *testing.T, token, query string) []string {
+	t.Helper()
+
+	w := (*s).serve((*s).tokenRequest(token, "GET", "/api/articles?"+query, ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("list %s: status = %d, want %d: %s", query, w.Code, http.StatusOK, w.Body)
+	}
+
+	var articles []domain.Article
+	if err := json.NewDecoder(w.Body).Decode(&articles); err != nil {
+		t.Fatal(err)
+	}
+	titles := []string{}
+	for _, article := range articles {
+		titles = append(titles, article.Title)
+	}
+	return titles
+}
+
+func TestArticleStatus(t *testing.T) {
+	s := newTestServer(t)
+	author := (*s).createUser(t, "jane", domain.RoleAuthor)
+	token := (*s).createToken(t, author, "articles:write")
+
+	article := (*s).createArticle(t, token, `{"title": "Hello", "content": "World"}`)
+	if article.Status != domain.ArticleDraft || article.PublishedAt != nil {
+		t.Fatalf("new article is %s published at %v, want an unpublished draft", article.Status, article.PublishedAt)
+	}
+	path := fmt.Sprintf("/api/articles/%d", article.ID)
+
+	// changeStatus posts to path+action and returns the article after it
+	changeStatus := func(action string) *domain.Article {
+		t.Helper()
+		w := (*s).serve((*s).tokenRequest(token, "POST", path+"/"+action, ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", action, w.Code, http.StatusOK, w.Body)
+		}
+		var changed domain.Article
+		if err := json.NewDecoder(w.Body).Decode(&changed); err != nil {
+			t.Fatal(err)
+		}
+		return &changed
+	}
+	// visible reports whether the public and the author can get the article
+	visible := func() (public, author bool) {
+		t.Helper()
+		public = (*s).serve((*s).tokenRequest("", "GET", path, "")).Code == http.StatusOK
+		author = (*s).serve((*s).tokenRequest(token, "GET", path, "")).Code == http.StatusOK
+		return public, author
+	}
+
+	if public, author := visible(); public || !author {
+		t.Errorf("draft: visible to the public %v and the author %v, want only the author", public, author)
+	}
+	if titles := (*s).listArticles(t, "", ""); len(titles) != 0 {
+		t.Errorf("draft listed publicly: %v", titles)
+	}
+
+	published := changeStatus("publish")
+	if published.Status != domain.ArticlePublished || published.PublishedAt == nil {
+		t.Fatalf("published article is %s published at %v", published.Status, published.PublishedAt)
+	}
+	if public, _ := visible(); !public {
+		t.Error("published article is not public")
+	}
+	if titles := (*s).listArticles(t, "", ""); len(titles) != 1 {
+		t.Errorf("published articles listed %v, want [Hello]", titles)
+	}
+
+	// archiving hides the article but keeps when it was first published
+	archived := changeStatus("archive")
+	if archived.Status != domain.ArticleArchived || archived.PublishedAt == nil || !archived.PublishedAt.Equal(*published.PublishedAt) {
+		t.Errorf("archived article is %s published at %v, want published_at kept", archived.Status, archived.PublishedAt)
+	}
+	if public, author := visible(); public || !author {
+		t.Errorf("archived: visible to the public %v and the author %v, want only the author", public, author)
+	}
+	if republished := changeStatus("publish"); !republished.PublishedAt.Equal(*published.PublishedAt) {
+		t.Errorf("published_at = %v after publishing again, want %v", republished.PublishedAt, published.PublishedAt)
+	}
+
+	unpublished := changeStatus("unpublish")
+	if unpublished.Status != domain.ArticleDraft || unpublished.PublishedAt != nil {
+		t.Errorf("unpublished article is %s published at %v, want an unpublished draft", unpublished.Status, unpublished.PublishedAt)
+	}
+}
+
+func TestPublishOthersArticles(t *testing.T) {
+	s := newTestServer(t)
+	jane := (*s).createUser(t, "jane", domain.RoleAuthor)
+	john := (*s).createUser(t, "john", domain.RoleAuthor)
+	editor := (*s).createUser(t, "editor", domain.RoleEditor)
+	janeToken := (*s).createToken(t, jane, "articles:write")
+	johnToken := (*s).createToken(t, john, "articles:write")
+	editorToken := (*s).createToken(t, editor, "articles:write", "articles:edit_any")
+
+	article := (*s).createArticle(t, janeToken, `{"title": "Jane's draft", "content": "World"}`)
+	(*s).createArticle(t, johnToken, `{"title": "John's draft", "content": "World"}`)
+	path := fmt.Sprintf("/api/articles/%d", article.ID)
+
+	// other authors neither see nor publish the draft, editors do both
+	if w := (*s).serve((*s).tokenRequest(johnToken, "GET", path, "")); w.Code != http.StatusNotFound {
+		t.Errorf("other author get: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := (*s).serve((*s).tokenRequest(johnToken, "POST", path+"/publish", "")); w.Code != http.StatusForbidden {
+		t.Errorf("other author publish: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := (*s).serve((*s).tokenRequest("", "POST", path+"/publish", "")); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous publish: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := (*s).serve((*s).tokenRequest(editorToken, "POST", path+"/publish", "")); w.Code != http.StatusOK {
+		t.Errorf("editor publish: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	// drafts are only listed to staff, authors see their own
+	if w := (*s).serve((*s).tokenRequest("", "GET", "/api/articles?status=draft", "")); w.Code != http.StatusForbidden {
+		t.Errorf("anonymous drafts: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	tests := []struct {
+		token string
+		query string
+		want  string
+	}{
+		{token: "", query: "", want: "Jane's draft"},
+		{token: johnToken, query: "status=draft", want: "John's draft"},
+		{token: janeToken, query: "status=draft", want: ""},
+		{token: janeToken, query: "status=all", want: "Jane's draft"},
+		{token: editorToken, query: "status=all&sort=title", want: "Jane's draft,John's draft"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join((*s).listArticles(t, tt.token, tt.query), ","); got != tt.want {
+			t.Errorf("list %q: titles %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *BlogHandler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := (*h).service.GetRevisions(r.Context(), id)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+func (h *BlogHandler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	id, revision, err := (*h).getRevisionFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article or revision number", http.StatusBadRequest)
+		return
+	}
+
+	found, err := (*h).service.GetRevision(r.Context(), id, revision)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// DiffRevisions answers ?from=1&to=2 with a unified diff as plain text.
+func (h *BlogHandler) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	from, fromErr := strconv.Atoi(query.Get("from"))
+	to, toErr := strconv.Atoi(query.Get("to"))
+	if fromErr != nil || toErr != nil {
+		http.Error(w, "from and to must be revision numbers", http.StatusBadRequest)
+		return
+	}
+
+	unified, err := (*h).service.DiffRevisions(r.Context(), id, from, to)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(unified))
+}
+
+func (h *BlogHandler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	id, revision, err := (*h).getRevisionFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article or revision number", http.StatusBadRequest)
+		return
+	}
+
+	article, err := (*h).service.RestoreRevision(r.Context(), id, revision)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
+
+// -- helpers --
+func (h *BlogHandler) getRevisionFromPath(r *http.Request) (int, int, error) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	revision, err := strconv.Atoi(mux.Vars(r)["revision"])
+	return id, revision, err
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"blog-system/internal/domain"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	s := newTestServer(t)
+	author := (*s).createUser(t, "jane", domain.RoleAuthor)
+	token := (*s).createToken(t, author, "articles:write")
+
+	article := (*s).createArticle(t, token, `{"title": "Hello", "content": "World"}`)
+	path := fmt.Sprintf("/api/articles/%d", article.ID)
+
+	update := func(content string) {
+		t.Helper()
+		body := fmt.Sprintf(`{"content": %q}`, content)
+		if w := (*s).serve((*s).tokenRequest(token, "PUT", path, body)); w.Code != http.StatusOK {
+			t.Fatalf("update: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+	}
+	rewrite := func(line string) string {
+		lines := make([]string, 3000)
+		for i := range lines {
+			lines[i] = fmt.Sprintf("%s %d", line, i)
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	update("Everyone")
+	update(rewrite("first"))
+	update(rewrite("second"))
+
+	w := (*s).serve((*s).tokenRequest(token, "GET", path+"/revisions/diff?from=1&to=2", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "-World\n+Everyone\n") {
+		t.Errorf("diff does not show the change:\n%s", w.Body)
+	}
+
+	// completely rewritten articles are too costly to compare
+	w = (*s).serve((*s).tokenRequest(token, "GET", path+"/revisions/diff?from=3&to=4", ""))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"blog-system/internal/domain"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+// Search answers ?q= with published articles, best matches first. All words
+// and "quoted phrases" must match, a trailing * matches by prefix. Results can
+// be limited to a tag and an author, and are paged with page and per_page.
+func (h *BlogHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page, err := positiveQueryInt(query, "page", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	perPage, err := positiveQueryInt(query, "per_page", defaultSearchPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	perPage = min(perPage, maxSearchPageSize)
+
+	results, total, err := (*h).service.Search(domain.SearchQuery{
+		Text:   query.Get("q"),
+		Author: query.Get("author"),
+		Tag:    query.Get("tag"),
+		Limit:  perPage,
+		Offset: (page - 1) * perPage,
+	})
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":  results,
+		"total":    total,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
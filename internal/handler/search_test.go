@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSearchUnavailable(t *testing.T) {
+	s := newTestServer(t)
+
+	search := func(query string) int {
+		return (*s).serve((*s).tokenRequest("", "GET", "/api/search?"+query, "")).Code
+	}
+
+	if code := search("q=+"); code != http.StatusBadRequest {
+		t.Errorf("empty search: status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// servers built with sqlite_fts5 search until the index is gone
+	available, err := (*s).repo.SearchAvailable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		if code := search("q=hello"); code != http.StatusOK {
+			t.Errorf("status = %d, want %d", code, http.StatusOK)
+		}
+		if _, err := (*s).db.Exec(`DROP TABLE articles_fts`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code := search("q=hello"); code != http.StatusNotImplemented {
+		t.Errorf("without an index: status = %d, want %d", code, http.StatusNotImplemented)
+	}
+}
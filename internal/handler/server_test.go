@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+	"blog-system/internal/service"
+	"blog-system/pkg/database"
+	"blog-system/pkg/mailer"
+
+	"github.com/gorilla/mux"
+)
+
+// testServer wires the handlers the way cmd/server does, on a fresh database.
+type testServer struct {
+	db             *sql.DB
+	repo           *repository.SQLiteRepository
+	router         *mux.Router
+	sessionManager *auth.SessionManager
+	userService    *service.UserService
+	tokenService   *service.TokenService
+	audit          *service.AuditLogger
+	mail           *mailer.CaptureMailer
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "blog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repo := repository.NewSQLiteRepository(db)
+	sessionManager := auth.NewSessionManager("test-secret", nil, auth.NewSQLiteStore(db), auth.SessionTimeouts{
+		Idle:     2 * time.Hour,
+		Absolute: 24 * time.Hour,
+		Remember: 30 * 24 * time.Hour,
+	})
+	loginLimiter := auth.NewLoginLimiter(auth.NewMemoryAttemptStore(), auth.DefaultIPPolicy, auth.DefaultAccountPolicy)
+	auditLogger := service.NewAuditLogger(repo)
+	userService := service.NewUserService(repo, repo, sessionManager, "blog-test")
+	tokenService := service.NewTokenService(repo, repo)
+	mail := mailer.NewQuietCaptureMailer()
+	magicLinkService := service.NewMagicLinkService(repo, repo, sessionManager, mail, "http://blog.test")
+	passwordResetService := service.NewPasswordResetService(repo, repo, sessionManager, mail, "http://blog.test")
+
+	r := mux.NewRouter()
+	api := (*r).PathPrefix("/api").Subrouter()
+
+	authenticate := auth.AuthMiddleware(sessionManager, userService, tokenService)
+	csrf := auth.CSRFMiddleware(sessionManager)
+	protect := func(next http.Handler) http.Handler {
+		return authenticate(csrf(next))
+	}
+	identify := auth.OptionalAuthMiddleware(sessionManager, userService, tokenService)
+
+	NewBlogHandler(service.NewBlogService(repo, auditLogger)).RegisterRoutes(api, protect, identify)
+	NewAuthHandler(sessionManager, userService, loginLimiter, magicLinkService, auditLogger).RegisterRoutes(api, protect)
+	NewUserHandler(userService, sessionManager, loginLimiter, auditLogger).RegisterRoutes(api, protect)
+	NewTokenHandler(tokenService, auditLogger).RegisterRoutes(api, protect)
+	NewPasswordHandler(userService, passwordResetService, sessionManager, loginLimiter, auditLogger).RegisterRoutes(api, protect)
+	NewAuditHandler(auditLogger).RegisterRoutes(api, protect)
+	(*r).Use(auth.ClientInfoMiddleware)
+
+	return &testServer{
+		db:             db,
+		repo:           repo,
+		router:         r,
+		sessionManager: sessionManager,
+		userService:    userService,
+		tokenService:   tokenService,
+		audit:          auditLogger,
+		mail:           mail,
+	}
+}
+
+func (s *testServer) createUser(t *testing.T, username string, role domain.Role) *domain.User {
+	t.Helper()
+
+	user, err := (*s).userService.CreateUser(username, "", "correct horse battery", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// mailedToken returns the token of the link in the last mail sent to the
+// address.
+func (s *testServer) mailedToken(t *testing.T, email string) string {
+	t.Helper()
+
+	message, ok := (*s).mail.Last(email)
+	if !ok {
+		t.Fatalf("no mail sent to %s", email)
+	}
+	for _, field := range strings.Fields(message.Body) {
+		if link, err := url.Parse(field); err == nil && link.Query().Has("token") {
+			return link.Query().Get("token")
+		}
+	}
+	t.Fatalf("no link in the mail:\n%s", message.Body)
+	return ""
+}
+
+// createSession logs the user in, as if with their password.
+func (s *testServer) createSession(t *testing.T, user *domain.User) *auth.Session {
+	t.Helper()
+
+	session, err := (*s).sessionManager.CreateSession(user.ID, auth.ClientInfo{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func (s *testServer) createToken(t *testing.T, user *domain.User, scopes ...string) string {
+	t.Helper()
+
+	plaintext, _, err := (*s).tokenService.CreateToken(user, "test", scopes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plaintext
+}
+
+// sessionRequest is a request authenticated with the session's cookie and
+// carrying its CSRF token.
+func (s *testServer) sessionRequest(session *auth.Session, method, path, body string) *http.Request {
+	w := httptest.NewRecorder()
+	(*s).sessionManager.SetSessionCookie(w, session)
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	r.Header.Set(auth.CSRFHeaderName, (*s).sessionManager.CSRFToken(session))
+	return r
+}
+
+// tokenRequest is a request authenticated with an API token, anonymous when
+// token is empty.
+func (s *testServer) tokenRequest(token, method, path, body string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func (s *testServer) serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	(*s).router.ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+)
+
+func TestLoginRecordsSessionMetadata(t *testing.T) {
+	s := newTestServer(t)
+	user := (*s).createUser(t, "jane", domain.RoleAuthor)
+
+	r := httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(`{"username": "jane", "password": "correct horse battery"}`))
+	r.RemoteAddr = "198.51.100.7:52100"
+	r.Header.Set("User-Agent", "test-browser/1.0")
+
+	w := (*s).serve(r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	sessions, err := (*s).sessionManager.ListUserSessions(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("%d sessions, want 1", len(sessions))
+	}
+	if sessions[0].IP != "198.51.100.7" || sessions[0].UserAgent != "test-browser/1.0" {
+		t.Errorf("session recorded IP %q and user agent %q", sessions[0].IP, sessions[0].UserAgent)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	s := newTestServer(t)
+	user := (*s).createUser(t, "jane", domain.RoleAuthor)
+	current := (*s).createSession(t, user)
+	other := (*s).createSession(t, user)
+	(*s).createSession(t, (*s).createUser(t, "john", domain.RoleAuthor))
+
+	w := (*s).serve((*s).sessionRequest(current, "GET", "/api/auth/sessions", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if strings.Contains(w.Body.String(), current.ID) || strings.Contains(w.Body.String(), other.ID) {
+		t.Error("session IDs are listed, they should be hidden behind handles")
+	}
+
+	var sessions []sessionResponse
+	if err := json.NewDecoder(w.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	currentFlags := map[string]bool{}
+	for _, session := range sessions {
+		currentFlags[session.ID] = session.Current
+	}
+	want := map[string]bool{current.Handle(): true, other.Handle(): false}
+	if len(currentFlags) != len(want) || currentFlags[current.Handle()] != true || currentFlags[other.Handle()] != false {
+		t.Errorf("listed sessions %v, want %v", currentFlags, want)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	s := newTestServer(t)
+	user := (*s).createUser(t, "jane", domain.RoleAuthor)
+	stranger := (*s).createSession(t, (*s).createUser(t, "john", domain.RoleAuthor))
+
+	current := (*s).createSession(t, user)
+	other := (*s).createSession(t, user)
+
+	// another user's session cannot be revoked
+	w := (*s).serve((*s).sessionRequest(current, "DELETE", "/api/auth/sessions/"+stranger.Handle(), ""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("revoking another user's session: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if _, exists := (*s).sessionManager.GetSession(stranger.ID); !exists {
+		t.Error("another user's session was revoked")
+	}
+
+	w = (*s).serve((*s).sessionRequest(current, "DELETE", "/api/auth/sessions/"+other.Handle(), ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if _, exists := (*s).sessionManager.GetSession(other.ID); exists {
+		t.Error("revoked session still exists")
+	}
+	if _, exists := (*s).sessionManager.GetSession(current.ID); !exists {
+		t.Error("current session was revoked too")
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	s := newTestServer(t)
+	user := (*s).createUser(t, "jane", domain.RoleAuthor)
+	stranger := (*s).createSession(t, (*s).createUser(t, "john", domain.RoleAuthor))
+
+	current := (*s).createSession(t, user)
+	others := []string{(*s).createSession(t, user).ID, (*s).createSession(t, user).ID}
+
+	w := (*s).serve((*s).sessionRequest(current, "DELETE", "/api/auth/sessions", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	for _, id := range others {
+		if _, exists := (*s).sessionManager.GetSession(id); exists {
+			t.Errorf("session %s survived", id[:8])
+		}
+	}
+	for _, id := range []string{current.ID, stranger.ID} {
+		if _, exists := (*s).sessionManager.GetSession(id); !exists {
+			t.Errorf("session %s was revoked", id[:8])
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestServer(t)
+	user := (*s).createUser(t, "jane", domain.RoleAuthor)
+	session := (*s).createSession(t, user)
+
+	// a cross-site form post carries the cookie but not the CSRF token
+	r := (*s).sessionRequest(session, "POST", "/api/auth/logout", "")
+	r.Header.Del(auth.CSRFHeaderName)
+	if w := (*s).serve(r); w.Code != http.StatusForbidden {
+		t.Errorf("without CSRF token: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if _, exists := (*s).sessionManager.GetSession(session.ID); !exists {
+		t.Fatal("session ended without a CSRF token")
+	}
+
+	w := (*s).serve((*s).sessionRequest(session, "POST", "/api/auth/logout", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if _, exists := (*s).sessionManager.GetSession(session.ID); exists {
+		t.Error("session still exists after logout")
+	}
+	cleared := false
+	for _, cookie := range w.Result().Cookies() {
+		cleared = cleared || (cookie.Name == auth.SessionCookieName && cookie.Value == "")
+	}
+	if !cleared {
+		t.Error("session cookie not cleared")
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"blog-system/internal/domain"
+)
+
+func TestArticleSlugs(t *testing.T) {
+	s := newTestServer(t)
+	author := (*s).createUser(t, "jane", domain.RoleAuthor)
+	token := (*s).createToken(t, author, "articles:write")
+
+	first := (*s).createArticle(t, token, `{"title": "Hello World", "content": "First", "status": "published"}`)
+	second := (*s).createArticle(t, token, `{"title": "Hello, world!", "content": "Second", "status": "published"}`)
+	if first.Slug != "hello-world" || second.Slug != "hello-world-2" {
+		t.Fatalf("slugs %q and %q, want hello-world and hello-world-2", first.Slug, second.Slug)
+	}
+
+	setSlug := func(article *domain.Article, requested string) *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/api/articles/%d/slug", article.ID)
+		return (*s).serve((*s).tokenRequest(token, "PUT", path, fmt.Sprintf(`{"slug": %q}`, requested)))
+	}
+
+	w := setSlug(first, "Greetings, World")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var renamed domain.Article
+	if err := json.NewDecoder(w.Body).Decode(&renamed); err != nil {
+		t.Fatal(err)
+	}
+	if renamed.Slug != "greetings-world" {
+		t.Errorf("slug = %q, want greetings-world", renamed.Slug)
+	}
+
+	// the old slug redirects, and stays reserved for the article
+	w = (*s).serve((*s).tokenRequest("", "GET", "/api/articles/by-slug/hello-world", ""))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/api/articles/by-slug/greetings-world" {
+		t.Errorf("old slug: status = %d to %q, want %d to the new slug", w.Code, w.Header().Get("Location"), http.StatusMovedPermanently)
+	}
+	if w := (*s).serve((*s).tokenRequest("", "GET", "/api/articles/by-slug/greetings-world", "")); w.Code != http.StatusOK {
+		t.Errorf("new slug: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if third := (*s).createArticle(t, token, `{"title": "Hello World", "content": "Third"}`); third.Slug != "hello-world-3" {
+		t.Errorf("third slug = %q, want hello-world-3", third.Slug)
+	}
+
+	tests := []struct {
+		slug string
+		want int
+	}{
+		{slug: "greetings-world", want: http.StatusConflict},
+		{slug: "hello-world", want: http.StatusConflict},
+		{slug: "!!!", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := setSlug(second, tt.slug); w.Code != tt.want {
+			t.Errorf("slug %q: status = %d, want %d: %s", tt.slug, w.Code, tt.want, w.Body)
+		}
+	}
+
+	// the article can take its own old slug back
+	if w := setSlug(first, "hello-world"); w.Code != http.StatusOK {
+		t.Errorf("own old slug: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if w := (*s).serve((*s).tokenRequest("", "GET", "/api/articles/by-slug/unknown", "")); w.Code != http.StatusNotFound {
+		t.Errorf("unknown slug: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
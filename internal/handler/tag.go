@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetTags lists every tag with the number of published articles that have it.
+func (h *BlogHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := (*h).service.GetTags()
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (h *BlogHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := (*h).service.CreateTag(r.Context(), req.Name)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (h *BlogHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := (*h).service.RenameTag(r.Context(), id, req.Name)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// MergeTag takes {"into": id} and answers with the remaining tag.
+func (h *BlogHandler) MergeTag(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Into int `json:"into"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := (*h).service.MergeTags(r.Context(), id, req.Into)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (h *BlogHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := (*h).service.DeleteTag(r.Context(), id); err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// AddArticleTags takes {"tags": ["go", "sqlite"]}, tags the article already
+// has are left alone.
+func (h *BlogHandler) AddArticleTags(w http.ResponseWriter, r *http.Request) {
+	(*h).changeArticleTags(w, r, false)
+}
+
+// SetArticleTags takes {"tags": [...]} and removes every other tag.
+func (h *BlogHandler) SetArticleTags(w http.ResponseWriter, r *http.Request) {
+	(*h).changeArticleTags(w, r, true)
+}
+
+func (h *BlogHandler) RemoveArticleTag(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+	tagID, err := strconv.Atoi(mux.Vars(r)["tag_id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	article, err := (*h).service.RemoveArticleTag(r.Context(), id, tagID)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
+
+// -- helpers --
+func (h *BlogHandler) changeArticleTags(w http.ResponseWriter, r *http.Request, replace bool) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	change := (*h).service.AddArticleTags
+	if replace {
+		change = (*h).service.SetArticleTags
+	}
+	article, err := change(r.Context(), id, req.Tags)
+	if err != nil {
+		writeBlogError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blog-system/internal/domain"
+)
+
+func TestMergeTags(t *testing.T) {
+	s := newTestServer(t)
+	author := (*s).createUser(t, "jane", domain.RoleAuthor)
+	editor := (*s).createUser(t, "editor", domain.RoleEditor)
+	authorToken := (*s).createToken(t, author, "articles:write")
+	editorToken := (*s).createToken(t, editor, "articles:write", "articles:edit_any")
+
+	both := (*s).createArticle(t, authorToken, `{"title": "Both", "content": "Content", "tags": ["go", "golang"], "status": "published"}`)
+	(*s).createArticle(t, authorToken, `{"title": "Golang", "content": "Content", "tags": ["golang"], "status": "published"}`)
+	(*s).createArticle(t, authorToken, `{"title": "Draft", "content": "Content", "tags": ["go", "drafts"]}`)
+
+	tagIDs := map[string]int{}
+	for _, tag := range both.Tags {
+		tagIDs[tag.Name] = tag.ID
+	}
+
+	// usage only counts published articles, tags of drafts are still listed
+	if got, want := (*s).tagUsage(t), "drafts:0,go:1,golang:2"; got != want {
+		t.Errorf("tags before merging %s, want %s", got, want)
+	}
+
+	merge := func(token string, source, target int) *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/api/tags/%d/merge", source)
+		return (*s).serve((*s).tokenRequest(token, "POST", path, fmt.Sprintf(`{"into": %d}`, target)))
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		source int
+		target int
+		want   int
+	}{
+		{name: "author", token: authorToken, source: tagIDs["golang"], target: tagIDs["go"], want: http.StatusForbidden},
+		{name: "into itself", token: editorToken, source: tagIDs["go"], target: tagIDs["go"], want: http.StatusBadRequest},
+		{name: "into a missing tag", token: editorToken, source: tagIDs["golang"], target: 999, want: http.StatusNotFound},
+		{name: "missing tag", token: editorToken, source: 999, target: tagIDs["go"], want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := merge(tt.token, tt.source, tt.target); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+
+	w := merge(editorToken, tagIDs["golang"], tagIDs["go"])
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var kept domain.Tag
+	if err := json.NewDecoder(w.Body).Decode(&kept); err != nil {
+		t.Fatal(err)
+	}
+	if kept.ID != tagIDs["go"] || kept.Name != "go" {
+		t.Errorf("merged into %+v, want go", kept)
+	}
+
+	// the articles moved to go, the one that had both has it once
+	if got, want := (*s).tagUsage(t), "drafts:0,go:2"; got != want {
+		t.Errorf("tags after merging %s, want %s", got, want)
+	}
+	if titles := strings.Join((*s).listArticles(t, "", "tag=go&sort=title"), ","); titles != "Both,Golang" {
+		t.Errorf("articles tagged go: %s, want Both,Golang", titles)
+	}
+	w = (*s).serve((*s).tokenRequest("", "GET", fmt.Sprintf("/api/articles/%d", both.ID), ""))
+	var article domain.Article
+	if err := json.NewDecoder(w.Body).Decode(&article); err != nil {
+		t.Fatal(err)
+	}
+	if len(article.Tags) != 1 || article.Tags[0].Name != "go" {
+		t.Errorf("tags of Both = %v, want [go]", article.Tags)
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	s := newTestServer(t)
+	editor := (*s).createUser(t, "editor", domain.RoleEditor)
+	token := (*s).createToken(t, editor, "articles:write", "articles:edit_any")
+
+	article := (*s).createArticle(t, token, `{"title": "Hello", "content": "Content", "tags": ["go", "sqlite"], "status": "published"}`)
+	var goID int
+	for _, tag := range article.Tags {
+		if tag.Name == "go" {
+			goID = tag.ID
+		}
+	}
+	rename := func(name string) int {
+		path := fmt.Sprintf("/api/tags/%d", goID)
+		return (*s).serve((*s).tokenRequest(token, "PUT", path, fmt.Sprintf(`{"name": %q}`, name))).Code
+	}
+
+	tests := []struct {
+		name string
+		want int
+	}{
+		{name: "sqlite", want: http.StatusConflict},
+		{name: "  ", want: http.StatusBadRequest},
+		{name: strings.Repeat("x", 51), want: http.StatusBadRequest},
+		{name: "golang", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := rename(tt.name); code != tt.want {
+			t.Errorf("rename to %q: status = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	if got, want := (*s).tagUsage(t), "golang:1,sqlite:1"; got != want {
+		t.Errorf("tags %s, want %s", got, want)
+	}
+}
+
+// tagUsage returns the tags listed by GET /api/tags as name:count pairs.
+func (s *testServer) tagUsage(t *testing.T) string {
+	t.Helper()
+
+	w := (*s).serve((*s).tokenRequest("", "GET", "/api/tags", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("tags: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var tags []domain.TagUsage
+	if err := json.NewDecoder(w.Body).Decode(&tags); err != nil {
+		t.Fatal(err)
+	}
+	var usage []string
+	for _, tag := range tags {
+		usage = append(usage, fmt.Sprintf("%s:%d", tag.Name, tag.ArticleCount))
+	}
+	return strings.Join(usage, ",")
+}
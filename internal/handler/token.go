@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+type TokenHandler struct {
+	service *service.TokenService
+	audit   *service.AuditLogger
+}
+
+func NewTokenHandler(service *service.TokenService, audit *service.AuditLogger) *TokenHandler {
+	return &TokenHandler{
+		service: service,
+		audit:   audit,
+	}
+}
+
+func (h *TokenHandler) RegisterRoutes(r *mux.Router, protect mux.MiddlewareFunc) {
+	protected := (*r).PathPrefix("/auth/tokens").Subrouter()
+	(*protected).Use(protect)
+	(*protected).Use(requireSession)
+
+	(*protected).HandleFunc("", (*h).GetTokens).Methods("GET")
+	(*protected).HandleFunc("", (*h).CreateToken).Methods("POST")
+	(*protected).HandleFunc("/{id:[0-9]+}", (*h).RevokeToken).Methods("DELETE")
+}
+
+func (h *TokenHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+
+	tokens, err := (*h).service.GetTokens(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tokens == nil {
+		tokens = []*domain.APIToken{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	lifetime := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	plaintext, token, err := (*h).service.CreateToken(user, req.Name, req.Scopes, lifetime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditAPITokenCreated,
+		TargetType: "api_token",
+		TargetID:   strconv.Itoa(token.ID),
+		After:      map[string]any{"name": token.Name, "scopes": token.Scopes, "expires_at": token.ExpiresAt},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":     plaintext,
+		"api_token": token,
+	})
+}
+
+func (h *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := (*h).service.RevokeToken(user.ID, id); err != nil {
+		if errors.Is(err, service.ErrAPITokenNotFound) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditAPITokenRevoked,
+		TargetType: "api_token",
+		TargetID:   strconv.Itoa(id),
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// -- helpers --
+
+// requireSession keeps API tokens from managing credentials, otherwise a
+// leaked token could mint itself a longer-lived replacement.
+func requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.GetSessionFromContext(r.Context()); !ok {
+			http.Error(w, "This endpoint requires a session login", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
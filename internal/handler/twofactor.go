@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/service"
+)
+
+// LoginSecondFactor exchanges the pre-auth token returned by Login, together
+// with a TOTP code or a recovery code, for a session.
+func (h *AuthHandler) LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PreAuthToken string `json:"pre_auth_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userID, remember, ok := (*h).sessionManager.VerifyPreAuthToken(req.PreAuthToken)
+	if !ok {
+		http.Error(w, "Invalid or expired pre-auth token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := (*h).userService.GetUser(userID)
+	if err != nil {
+		http.Error(w, "Invalid or expired pre-auth token", http.StatusUnauthorized)
+		return
+	}
+
+	// codes are only a million possibilities, guesses count as failed logins
+	client := auth.ClientInfoFromRequest(r)
+	retryAfter, err := (*h).loginLimiter.Check(client.IP, user.Username)
+	if err != nil {
+		http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		(*h).recordLoginFailure(r, user, user.Username, "throttled")
+		writeTooManyAttempts(w, retryAfter)
+		return
+	}
+
+	if _, err := (*h).userService.VerifySecondFactor(userID, req.PreAuthToken, req.Code, req.RecoveryCode); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTOTPCode):
+			(*h).recordLoginFailure(r, user, user.Username, "invalid_second_factor")
+			if err := (*h).loginLimiter.RecordFailure(client.IP, user.Username); err != nil {
+				http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrInvalidPreAuth):
+			http.Error(w, "Invalid or expired pre-auth token", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrUserDisabled):
+			http.Error(w, "Account is disabled", http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := (*h).loginLimiter.RecordSuccess(user.Username); err != nil {
+		http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		return
+	}
+
+	method := "password+totp"
+	if req.RecoveryCode != "" {
+		method = "password+recovery_code"
+	}
+	(*h).startSession(w, r, user, remember, method)
+}
+
+func (h *AuthHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+
+	secret, uri, err := (*h).userService.BeginTOTPEnrollment(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": uri,
+	})
+}
+
+func (h *AuthHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := (*h).userService.ConfirmTOTPEnrollment(user.ID, req.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditTwoFactorEnabled,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(user.ID),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func (h *AuthHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+
+	var req struct {
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := (*h).userService.DisableTOTP(user.ID, req.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditTwoFactorDisabled,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(user.ID),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.GetUserFromContext(r.Context())
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := (*h).userService.RegenerateRecoveryCodes(user.ID, req.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     service.AuditRecoveryCodesRenewed,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(user.ID),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
@@ -0,0 +1,425 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+type UserHandler struct {
+	service        *service.UserService
+	sessionManager *auth.SessionManager
+	loginLimiter   *auth.LoginLimiter
+	audit          *service.AuditLogger
+}
+
+func NewUserHandler(service *service.UserService, sessionManager *auth.SessionManager, loginLimiter *auth.LoginLimiter, audit *service.AuditLogger) *UserHandler {
+	return &UserHandler{
+		service:        service,
+		sessionManager: sessionManager,
+		loginLimiter:   loginLimiter,
+		audit:          audit,
+	}
+}
+
+func (h *UserHandler) RegisterRoutes(r *mux.Router, protect mux.MiddlewareFunc) {
+	admin := (*r).PathPrefix("/admin").Subrouter()
+	(*admin).Use(protect)
+	(*admin).Use(auth.RequirePermission(auth.PermManageUsers))
+
+	userStemPath := "/users"
+	userSpecificPath := userStemPath + "/{id:[0-9]+}"
+
+	(*admin).HandleFunc(userStemPath, (*h).GetAllUsers).Methods("GET")
+	(*admin).HandleFunc(userStemPath, (*h).CreateUser).Methods("POST")
+	(*admin).HandleFunc(userSpecificPath+"/disable", (*h).DisableUser).Methods("POST")
+	(*admin).HandleFunc(userSpecificPath+"/enable", (*h).EnableUser).Methods("POST")
+	(*admin).HandleFunc(userSpecificPath+"/role", (*h).SetUserRole).Methods("PUT")
+	(*admin).HandleFunc(userSpecificPath+"/email", (*h).SetUserEmail).Methods("PUT")
+	(*admin).HandleFunc(userSpecificPath+"/2fa", (*h).ResetTwoFactor).Methods("DELETE")
+	(*admin).HandleFunc(userSpecificPath, (*h).DeleteUser).Methods("DELETE")
+
+	(*admin).HandleFunc(userSpecificPath+"/sessions", (*h).ListUserSessions).Methods("GET")
+	(*admin).HandleFunc(userSpecificPath+"/sessions", (*h).RevokeUserSessions).Methods("DELETE")
+	(*admin).HandleFunc(userSpecificPath+"/sessions/{session:[0-9a-f]+}", (*h).RevokeUserSession).Methods("DELETE")
+
+	(*admin).HandleFunc("/lockouts", (*h).ListLockouts).Methods("GET")
+	(*admin).HandleFunc("/lockouts", (*h).ClearLockout).Methods("DELETE")
+}
+
+func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := (*h).service.GetAllUsers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string      `json:"username"`
+		Email    string      `json:"email"`
+		Password string      `json:"password"`
+		Role     domain.Role `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	user, err := (*h).service.CreateUser(req.Username, req.Email, req.Password, req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	(*h).recordUserEvent(r, service.AuditUserCreated, user.ID, nil, map[string]any{
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *UserHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	(*h).setDisabled(w, r, true)
+}
+
+func (h *UserHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	(*h).setDisabled(w, r, false)
+}
+
+func (h *UserHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Role domain.Role `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if (*h).isCurrentUser(r, id) && req.Role != domain.RoleAdmin {
+		http.Error(w, "Cannot remove your own admin role", http.StatusBadRequest)
+		return
+	}
+
+	before, err := (*h).service.GetUser(id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	user, err := (*h).service.SetUserRole(id, req.Role)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	(*h).recordUserEvent(r, service.AuditUserRoleChanged, id,
+		map[string]any{"role": before.Role},
+		map[string]any{"role": user.Role})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *UserHandler) SetUserEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	before, err := (*h).service.GetUser(id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	user, err := (*h).service.SetUserEmail(id, req.Email)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	(*h).recordUserEvent(r, service.AuditUserEmailChanged, id,
+		map[string]any{"email": before.Email},
+		map[string]any{"email": user.Email})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if (*h).isCurrentUser(r, id) {
+		http.Error(w, "Cannot delete your own account", http.StatusBadRequest)
+		return
+	}
+
+	user, err := (*h).service.GetUser(id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	if err := (*h).service.DeleteUser(id); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	if err := (*h).sessionManager.DeleteUserSessions(id); err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).recordUserEvent(r, service.AuditUserDeleted, id, map[string]any{
+		"username": user.Username,
+		"role":     user.Role,
+	}, nil)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := (*h).service.ResetTOTP(id); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	(*h).recordUserEvent(r, service.AuditUserTwoFactorReset, id, nil, nil)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// -- sessions --
+func (h *UserHandler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := (*h).getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := (*h).sessionManager.ListUserSessions(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	current, _ := auth.GetSessionFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSessionResponses(sessions, current))
+}
+
+func (h *UserHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := (*h).getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// an admin revoking their own sessions keeps the one they are using,
+	// API token requests have none to keep
+	var err error
+	if current, ok := auth.GetSessionFromContext(r.Context()); ok {
+		err = (*h).sessionManager.DeleteOtherUserSessions(user.ID, current.ID)
+	} else {
+		err = (*h).sessionManager.DeleteUserSessions(user.ID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).recordUserEvent(r, service.AuditUserSessionsRevoked, user.ID, nil, nil)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := (*h).getUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	session, exists := (*h).sessionManager.FindUserSession(user.ID, mux.Vars(r)["session"])
+	if !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := (*h).sessionManager.DeleteSession(session.ID); err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	(*h).recordUserEvent(r, service.AuditUserSessionsRevoked, user.ID, nil, map[string]any{"session": session.Handle()})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// -- lockouts --
+func (h *UserHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	locked, err := (*h).loginLimiter.ListLocked()
+	if err != nil {
+		http.Error(w, "Failed to list lockouts", http.StatusInternalServerError)
+		return
+	}
+	if locked == nil {
+		locked = []*auth.LoginAttempts{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locked)
+}
+
+// ClearLockout lifts the lockout of ?username= and/or ?ip=.
+func (h *UserHandler) ClearLockout(w http.ResponseWriter, r *http.Request) {
+	username := r.URL.Query().Get("username")
+	ip := r.URL.Query().Get("ip")
+	if username == "" && ip == "" {
+		http.Error(w, "username or ip query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	if username != "" {
+		keys = append(keys, auth.AccountAttemptKey(username))
+	}
+	if ip != "" {
+		keys = append(keys, auth.IPAttemptKey(ip))
+	}
+
+	for _, key := range keys {
+		if err := (*h).loginLimiter.Clear(key); err != nil {
+			http.Error(w, "Failed to clear lockout", http.StatusInternalServerError)
+			return
+		}
+
+		(*h).audit.Record(r.Context(), service.AuditEntry{
+			Action:     service.AuditLockoutCleared,
+			TargetType: "lockout",
+			TargetID:   key,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// -- helpers --
+func (h *UserHandler) getUserFromPath(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := (*h).service.GetUser(id)
+	if err != nil {
+		writeUserError(w, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *UserHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, err := (*h).getIDFromPath(r)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if disabled && (*h).isCurrentUser(r, id) {
+		http.Error(w, "Cannot disable your own account", http.StatusBadRequest)
+		return
+	}
+
+	user, err := (*h).service.SetUserDisabled(id, disabled)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	if disabled {
+		if err := (*h).sessionManager.DeleteUserSessions(id); err != nil {
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	action := service.AuditUserEnabled
+	if disabled {
+		action = service.AuditUserDisabled
+	}
+	(*h).recordUserEvent(r, action, id, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *UserHandler) recordUserEvent(r *http.Request, action string, userID int, before, after map[string]any) {
+	(*h).audit.Record(r.Context(), service.AuditEntry{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(userID),
+		Before:     before,
+		After:      after,
+	})
+}
+
+func (h *UserHandler) isCurrentUser(r *http.Request, id int) bool {
+	user, ok := auth.GetUserFromContext(r.Context())
+	return ok && user.ID == id
+}
+
+func (h *UserHandler) getIDFromPath(r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	return strconv.Atoi(vars["id"])
+}
+
+func writeUserError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
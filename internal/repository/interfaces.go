@@ -1,21 +1,129 @@
 package repository
 
-import "blog-system/internal/domain"
+import (
+	"time"
+
+	"blog-system/internal/domain"
+)
 
 type BlogRepository interface {
+	// Transaction runs fn with a repository whose changes are all kept when
+	// fn returns nil and all undone otherwise
+	Transaction(fn func(repo BlogRepository) error) error
+
 	CreateArticle(article *domain.Article) error
 	GetArticle(id int) (*domain.Article, error)
-	GetAllArticles() ([]*domain.Article, error)
+	GetArticleBySlug(slug string) (*domain.Article, error)
+	GetArticleIDByOldSlug(slug string) (int, error)
+	// IsSlugTaken checks current and old slugs of articles other than articleID
+	IsSlugTaken(slug string, articleID int) (bool, error)
+	SetArticleSlug(id int, slug string) error
+	ListArticles(query domain.ArticleQuery) (*domain.ArticlePage, error)
 	UpdateArticle(*domain.Article) error
+	SetRenderedContent(article *domain.Article) error
+	// SetArticleStatus also replaces published_at, nil clears it
+	SetArticleStatus(id int, status domain.ArticleStatus, publishedAt *time.Time) error
+	SetArticleSchedule(id int, publishAt, unpublishAt *time.Time, scheduledBy int) error
+	// GetScheduledArticles only uses query.AuthorID
+	GetScheduledArticles(query domain.ArticleQuery) ([]*domain.Article, error)
+	// PublishDueArticles and UnpublishDueArticles return the articles they
+	// changed, they are safe to run from several servers at once
+	PublishDueArticles(now time.Time) ([]*domain.Article, error)
+	UnpublishDueArticles(now time.Time) ([]*domain.Article, error)
 	DeleteArticle(id int) error
 
+	// SearchAvailable tells whether the database has a full-text index
+	SearchAvailable() (bool, error)
+	// SearchArticles returns a page of matches and the number of all of them
+	SearchArticles(query domain.SearchQuery) ([]*domain.SearchResult, int, error)
+
+	// CreateArticleRevision numbers the revision after the article's latest one
+	CreateArticleRevision(revision *domain.ArticleRevision) error
+	// GetArticleRevisions lists revisions newest first, without their content
+	GetArticleRevisions(articleID int) ([]*domain.ArticleRevision, error)
+	GetArticleRevision(articleID, revision int) (*domain.ArticleRevision, error)
+
 	CreateComment(comment *domain.Comment) error
+	GetComment(id int) (*domain.Comment, error)
 	GetCommentsByArticleID(articleID int) ([]*domain.Comment, error)
 	DeleteComment(id int) error
 
 	CreateTag(tag *domain.Tag) error
+	UpsertTag(name string) (*domain.Tag, error)
+	GetTag(id int) (*domain.Tag, error)
+	GetTagByName(name string) (*domain.Tag, error)
 	GetAllTags() ([]*domain.Tag, error)
+	GetTagUsage() ([]*domain.TagUsage, error)
+	RenameTag(id int, name string) error
+	// MergeTags moves the articles of sourceID to targetID and deletes sourceID
+	MergeTags(sourceID, targetID int) error
+	DeleteTag(id int) error
 	GetTagsByArticleID(articleID int) ([]*domain.Tag, error)
 	AddTagToArticle(articleID int, tagID int) error
 	RemoveTagFromArticle(articleID int, tagID int) error
 }
+
+type UserRepository interface {
+	CreateUser(user *domain.User) error
+	GetUser(id int) (*domain.User, error)
+	GetUserByUsername(username string) (*domain.User, error)
+	GetUserByEmail(email string) (*domain.User, error)
+	GetUserByOIDCSubject(subject string) (*domain.User, error)
+	GetAllUsers() ([]*domain.User, error)
+	CountUsers() (int, error)
+	SetUserDisabled(id int, disabled bool) error
+	SetUserRole(id int, role domain.Role) error
+	SetUserEmail(id int, email string) error
+	SetPasswordHash(id int, passwordHash string) error
+	// LinkOIDCSubject ties the user to an identity provider account
+	LinkOIDCSubject(id int, subject, email string) error
+	DeleteUser(id int) error
+
+	// SetTOTPSecret stores a pending secret, two-factor stays disabled until EnableTOTP
+	SetTOTPSecret(userID int, secret string) error
+	EnableTOTP(userID int) error
+	// DisableTOTP clears the secret and deletes the recovery codes
+	DisableTOTP(userID int) error
+	// AdvanceTOTPStep records step as the last used one, it returns false when
+	// an equal or later step was already recorded
+	AdvanceTOTPStep(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	// UseRecoveryCode marks an unused code as used, it returns false when
+	// there was no such code
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+}
+
+type APITokenRepository interface {
+	CreateAPIToken(token *domain.APIToken) error
+	GetAPITokenByHash(tokenHash string) (*domain.APIToken, error)
+	GetAPITokensByUserID(userID int) ([]*domain.APIToken, error)
+	TouchAPIToken(id int, lastUsed time.Time) error
+	DeleteAPIToken(userID int, id int) (bool, error)
+}
+
+// OneTimeTokenRepository records issued one-time tokens by hash, so that each
+// can be redeemed only once.
+type OneTimeTokenRepository interface {
+	CreateOneTimeToken(tokenHash string, userID int, purpose string, expiresAt, createdAt time.Time) error
+	// ConsumeOneTimeToken deletes an unexpired token, it returns false when
+	// there was no such token
+	ConsumeOneTimeToken(tokenHash, purpose string, now time.Time) (bool, error)
+	// CountOneTimeTokenAttempt records an attempt to use an unexpired token,
+	// it returns false when there was no such token or it had maxAttempts
+	CountOneTimeTokenAttempt(tokenHash, purpose string, now time.Time, maxAttempts int) (bool, error)
+	CountOneTimeTokensSince(userID int, purpose string, since time.Time) (int, error)
+	DeleteOneTimeTokens(userID int, purpose string) error
+	DeleteExpiredOneTimeTokens(now time.Time) error
+}
+
+// AuditRepository stores audit events, which are never updated or deleted.
+type AuditRepository interface {
+	CreateAuditEvent(event *domain.AuditEvent) error
+	// GetAuditEvents returns matching events newest first, honoring the
+	// filter's Limit and Offset
+	GetAuditEvents(filter domain.AuditFilter) ([]*domain.AuditEvent, error)
+	CountAuditEvents(filter domain.AuditFilter) (int, error)
+	// EachAuditEvent calls fn for every matching event newest first,
+	// ignoring Limit and Offset, and stops at the first error
+	EachAuditEvent(filter domain.AuditFilter, fn func(*domain.AuditEvent) error) error
+}
@@ -0,0 +1,105 @@
+//go:build sqlite_fts5
+
+package repository
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"blog-system/internal/domain"
+)
+
+func TestSearchArticles(t *testing.T) {
+	repo := newRepository(t, filepath.Join(t.TempDir(), "blog.db"))
+
+	available, err := (*repo).SearchAvailable()
+	if err != nil || !available {
+		t.Fatalf("search available = %v (%v), want true with sqlite_fts5", available, err)
+	}
+
+	articles := []struct {
+		title   string
+		content string
+		status  domain.ArticleStatus
+		tag     string
+	}{
+		{title: "Crème brûlée", content: "A dessert with a burnt sugar top.", status: domain.ArticlePublished, tag: "food"},
+		{title: "Databases", content: "SQLite keeps the whole database in one file.", status: domain.ArticlePublished},
+		{title: "Indexing <data>", content: "Full text search needs an index of the words.", status: domain.ArticlePublished},
+		{title: "Notes", content: "Creme brulee is mentioned here, and so are databases.", status: domain.ArticlePublished, tag: "food"},
+		{title: "Draft about databases", content: "Not public yet.", status: domain.ArticleDraft},
+	}
+	for _, a := range articles {
+		article := &domain.Article{Title: a.title, Slug: strings.ToLower(strings.Fields(a.title)[0]), Content: a.content, Author: "jane", Status: a.status}
+		if err := (*repo).CreateArticle(article); err != nil {
+			t.Fatal(err)
+		}
+		if a.tag != "" {
+			tag, err := (*repo).UpsertTag(a.tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := (*repo).AddTagToArticle(article.ID, tag.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query domain.SearchQuery
+		want  string
+	}{
+		// title matches rank above content matches
+		{name: "words", query: domain.SearchQuery{Text: "databases", Status: domain.ArticlePublished}, want: "<mark>Databases</mark>,Notes"},
+		{name: "diacritics ignored", query: domain.SearchQuery{Text: "creme brulee"}, want: "<mark>Crème</mark> <mark>brûlée</mark>,Notes"},
+		{name: "prefix", query: domain.SearchQuery{Text: "data*", Status: domain.ArticlePublished}, want: "<mark>Databases</mark>,Indexing &lt;<mark>data</mark>&gt;,Notes"},
+		{name: "phrase", query: domain.SearchQuery{Text: `"one file"`}, want: "Databases"},
+		{name: "all words", query: domain.SearchQuery{Text: "sqlite index"}, want: ""},
+		{name: "tag", query: domain.SearchQuery{Text: "creme", Tag: "food"}, want: "<mark>Crème</mark> brûlée,Notes"},
+		{name: "operators", query: domain.SearchQuery{Text: `NOT AND ( "`}, want: ""},
+		{name: "drafts included", query: domain.SearchQuery{Text: "public"}, want: "Draft about databases"},
+		{name: "drafts excluded", query: domain.SearchQuery{Text: "public", Status: domain.ArticlePublished}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Limit = 10
+			results, total, err := (*repo).SearchArticles(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var titles []string
+			for _, result := range results {
+				titles = append(titles, result.Title)
+			}
+			if got := strings.Join(titles, ","); got != tt.want || total != len(results) {
+				t.Errorf("results %s of %d, want %s", got, total, tt.want)
+			}
+		})
+	}
+
+	// the index follows updates and deletes
+	results, _, err := (*repo).SearchArticles(domain.SearchQuery{Text: "sugar", Limit: 10})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("%d results (%v), want 1", len(results), err)
+	}
+	id := results[0].ArticleID
+	if !strings.Contains(results[0].Snippet, "<mark>sugar</mark>") {
+		t.Errorf("snippet %q does not mark the match", results[0].Snippet)
+	}
+	if err := (*repo).UpdateArticle(&domain.Article{ID: id, Title: "Crème brûlée", Content: "A dessert with caramel."}); err != nil {
+		t.Fatal(err)
+	}
+	if results, _, _ := (*repo).SearchArticles(domain.SearchQuery{Text: "sugar", Limit: 10}); len(results) != 0 {
+		t.Errorf("%d results for a word removed by an update", len(results))
+	}
+	if err := (*repo).DeleteArticle(id); err != nil {
+		t.Fatal(err)
+	}
+	if results, _, _ := (*repo).SearchArticles(domain.SearchQuery{Text: "caramel", Limit: 10}); len(results) != 0 {
+		t.Errorf("%d results for a deleted article", len(results))
+	}
+}
@@ -0,0 +1,52 @@
+package repository
+
+import "testing"
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"go sqlite", `"go" "sqlite"`},
+		{`"hello world" go`, `"hello world" "go"`},
+		{"data*", `"data"*`},
+		{`"hello wor"*`, `"hello wor"*`},
+		{"data *", `"data"`},
+		{`"unterminated phrase`, `"unterminated phrase"`},
+		{`a"b`, `"a" "b"`},
+		{`say "it's"`, `"say" "it's"`},
+		// FTS5 operators and syntax are searched for as words
+		{"AND OR NOT", `"AND" "OR" "NOT"`},
+		{"title:secret", `"title:secret"`},
+		{"(x) NEAR(y)", `"(x)" "NEAR(y)"`},
+		{"-minus ^caret +plus", `"-minus" "^caret" "+plus"`},
+		{"", ""},
+		{"   ", ""},
+		{"***", ""},
+		{`""`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := matchExpression(tt.text); got != tt.want {
+			t.Errorf("matchExpression(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMarkMatches(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a " + matchStart + "match" + matchEnd + " here", "a <mark>match</mark> here"},
+		{"<script>" + matchStart + "x" + matchEnd + "</script>", "&lt;script&gt;<mark>x</mark>&lt;/script&gt;"},
+		{`"quoted" & 'single'`, "&#34;quoted&#34; &amp; &#39;single&#39;"},
+	}
+
+	for _, tt := range tests {
+		if got := markMatches(tt.text); got != tt.want {
+			t.Errorf("markMatches(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
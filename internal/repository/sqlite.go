@@ -3,20 +3,83 @@ package repository
 import (
 	"blog-system/internal/domain"
 	"database/sql"
+	"encoding/json"
+	"html"
+	"slices"
+	"strings"
+	"time"
 )
 
+// querier is what the repository needs from *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 type SQLiteRepository struct {
-	db *sql.DB
+	db querier
+	// conn starts transactions, it is nil for a repository inside one
+	conn *sql.DB
 }
 
 func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
-	return &SQLiteRepository{db: db}
+	return &SQLiteRepository{db: db, conn: db}
+}
+
+// Transaction runs fn with a repository whose changes are committed when fn
+// returns nil and rolled back otherwise. Inside a transaction fn joins it.
+func (r *SQLiteRepository) Transaction(fn func(repo BlogRepository) error) error {
+	return (*r).transaction(func(tx *SQLiteRepository) error {
+		return fn(tx)
+	})
+}
+
+func (r *SQLiteRepository) transaction(fn func(tx *SQLiteRepository) error) error {
+	if (*r).conn == nil {
+		return fn(r)
+	}
+
+	tx, err := (*r).conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLiteRepository{db: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // -- articles --
+const articleColumns = `id, title, slug, content, content_html, toc, render_version, author, author_id, status, published_at,
+	publish_at, unpublish_at, scheduled_by, created_at, updated_at,
+	(SELECT COUNT(*) FROM comments WHERE comments.article_id = articles.id)`
+
+// tagBatchSize keeps the number of parameters of a query well below
+// SQLite's limit when loading the tags of many articles.
+const tagBatchSize = 500
+
 func (r *SQLiteRepository) CreateArticle(article *domain.Article) error {
-	query := `INSERT INTO articles (title, content, author) VALUES (?, ?, ?)`
-	result, err := (*r).db.Exec(query, (*article).Title, (*article).Content, (*article).Author)
+	toc, err := json.Marshal((*article).TOC)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO articles (title, slug, content, content_html, toc, render_version, author, author_id, status, published_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := (*r).db.Exec(query,
+		(*article).Title,
+		nullableString((*article).Slug),
+		(*article).Content,
+		(*article).ContentHTML,
+		string(toc),
+		(*article).RenderVersion,
+		(*article).Author,
+		nullableID((*article).AuthorID),
+		(*article).Status,
+		nullableTime((*article).PublishedAt))
 	if err != nil {
 		return err
 	}
@@ -30,69 +93,410 @@ func (r *SQLiteRepository) CreateArticle(article *domain.Article) error {
 	return nil
 }
 
+// GetArticle returns the article with its tags and comment count, the
+// comments themselves are loaded separately.
 func (r *SQLiteRepository) GetArticle(id int) (*domain.Article, error) {
-	query := `SELECT id, title, content, author, created_at, updated_at FROM articles WHERE id = ?`
-	row := (*r).db.QueryRow(query, id)
+	return (*r).getArticle(`id = ?`, id)
+}
 
-	var article domain.Article
-	err := row.Scan(
-		&article.ID,
-		&article.Title,
-		&article.Content,
-		&article.Author,
-		&article.CreatedAt,
-		&article.UpdatedAt)
+func (r *SQLiteRepository) GetArticleBySlug(slug string) (*domain.Article, error) {
+	return (*r).getArticle(`slug = ?`, slug)
+}
+
+// getArticle loads the article matching condition the way ListArticles
+// loads a page of them.
+func (r *SQLiteRepository) getArticle(condition string, args ...any) (*domain.Article, error) {
+	query := `SELECT ` + articleColumns + ` FROM articles WHERE ` + condition
+	article, err := scanArticle((*r).db.QueryRow(query, args...))
 	if err != nil {
 		return nil, err
 	}
 
-	article.Tags, _ = (*r).GetTagsByArticleID(article.ID)
-	article.Comments, _ = (*r).GetCommentsByArticleID(article.ID)
+	if err := (*r).loadTags([]*domain.Article{article}); err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+// GetArticleIDByOldSlug finds the article that used to have slug.
+func (r *SQLiteRepository) GetArticleIDByOldSlug(slug string) (int, error) {
+	var id int
+	err := (*r).db.QueryRow(`SELECT article_id FROM article_slugs WHERE slug = ?`, slug).Scan(&id)
+	return id, err
+}
+
+func (r *SQLiteRepository) IsSlugTaken(slug string, articleID int) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM articles WHERE slug = ? AND id != ?)
+		OR EXISTS (SELECT 1 FROM article_slugs WHERE slug = ? AND article_id != ?)`
+	var taken bool
+	err := (*r).db.QueryRow(query, slug, articleID, slug, articleID).Scan(&taken)
+	return taken, err
+}
 
-	return &article, nil
+// SetArticleSlug changes the slug and keeps the previous one for redirects.
+func (r *SQLiteRepository) SetArticleSlug(id int, slug string) error {
+	return (*r).execAll([]statement{
+		{`INSERT OR IGNORE INTO article_slugs (article_id, slug) SELECT id, slug FROM articles WHERE id = ? AND slug IS NOT NULL`, []any{id}},
+		// the article may be getting one of its old slugs back
+		{`DELETE FROM article_slugs WHERE slug = ? AND article_id = ?`, []any{slug, id}},
+		{`UPDATE articles SET slug = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, []any{slug, id}},
+	})
 }
 
-func (r *SQLiteRepository) GetAllArticles() ([]*domain.Article, error) {
-	query := `SELECT id, title, content, author, created_at, updated_at FROM articles ORDER BY created_at DESC`
-	rows, err := (*r).db.Query(query)
+// articleSortKeys are the expressions articles are sorted by.
+var articleSortKeys = map[domain.ArticleSort]string{
+	domain.SortCreated:   "created_at",
+	domain.SortUpdated:   "updated_at",
+	domain.SortPublished: "COALESCE(published_at, created_at)",
+	domain.SortTitle:     "LOWER(title)",
+}
+
+// ListArticles returns a page of the matching articles. Pages are found by
+// the sort key and id of the article they continue from, so they stay in
+// place while articles are added.
+func (r *SQLiteRepository) ListArticles(query domain.ArticleQuery) (*domain.ArticlePage, error) {
+	sortKey, ok := articleSortKeys[query.Sort]
+	if !ok {
+		sortKey = articleSortKeys[domain.SortPublished]
+	}
+	dateKey := sortKey
+	if query.Sort == domain.SortTitle {
+		dateKey = articleSortKeys[domain.SortPublished]
+	}
+
+	conditions, args := articleConditions(query, dateKey)
+
+	page := &domain.ArticlePage{Articles: []*domain.Article{}}
+	if err := (*r).db.QueryRow(`SELECT COUNT(*) FROM articles`+whereClause(conditions), args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	// a page before the cursor is read backwards from it and reversed
+	backward := query.Before != nil
+	descending := query.Ascending == backward
+	cursor := query.After
+	if backward {
+		cursor = query.Before
+	}
+	if cursor != nil {
+		op := ">"
+		if descending {
+			op = "<"
+		}
+		conditions = append(conditions, "("+sortKey+" "+op+" ? OR ("+sortKey+" = ? AND id "+op+" ?))")
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+
+	direction := " ASC"
+	if descending {
+		direction = " DESC"
+	}
+	sqlQuery := `SELECT ` + articleColumns + `, CAST(` + sortKey + ` AS TEXT) FROM articles` + whereClause(conditions) +
+		` ORDER BY ` + sortKey + direction + `, id` + direction
+	if query.Limit > 0 {
+		// one more row tells whether there is another page
+		sqlQuery += ` LIMIT ?`
+		args = append(args, query.Limit+1)
+	}
+
+	rows, err := (*r).db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var articles []*domain.Article
+	var cursors []*domain.ArticleCursor
 	for rows.Next() {
-		var article domain.Article
-		err := rows.Scan(
-			&article.ID,
-			&article.Title,
-			&article.Content,
-			&article.Author,
-			&article.CreatedAt,
-			&article.UpdatedAt)
+		var key sql.NullString
+		article, err := scanArticle(rows, &key)
 		if err != nil {
 			return nil, err
 		}
 
-		article.Tags, _ = (*r).GetTagsByArticleID(article.ID)
-		articles = append(articles, &article)
+		page.Articles = append(page.Articles, article)
+		cursors = append(cursors, &domain.ArticleCursor{Key: key.String, ID: article.ID})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return articles, nil
+	more := query.Limit > 0 && len(page.Articles) > query.Limit
+	if more {
+		page.Articles = page.Articles[:query.Limit]
+		cursors = cursors[:query.Limit]
+	}
+	if backward {
+		slices.Reverse(page.Articles)
+		slices.Reverse(cursors)
+	}
+	if err := (*r).loadTags(page.Articles); err != nil {
+		return nil, err
+	}
+	if len(cursors) == 0 {
+		return page, nil
+	}
+
+	// the article the cursor points at lies on the other side
+	first, last := cursors[0], cursors[len(cursors)-1]
+	if backward {
+		page.Next = last
+		if more {
+			page.Prev = first
+		}
+	} else {
+		if more {
+			page.Next = last
+		}
+		if cursor != nil {
+			page.Prev = first
+		}
+	}
+
+	return page, nil
 }
 
 func (r *SQLiteRepository) UpdateArticle(article *domain.Article) error {
-	query := `UPDATE articles SET title = ?, content = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := (*r).db.Exec(query, (*article).Title, (*article).Content, (*article).ID)
+	toc, err := json.Marshal((*article).TOC)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE articles SET title = ?, content = ?, content_html = ?, toc = ?, render_version = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err = (*r).db.Exec(query, (*article).Title, (*article).Content, (*article).ContentHTML, string(toc), (*article).RenderVersion, (*article).ID)
+	return err
+}
+
+// SetRenderedContent replaces the cached HTML and table of contents without
+// counting as an edit.
+func (r *SQLiteRepository) SetRenderedContent(article *domain.Article) error {
+	toc, err := json.Marshal((*article).TOC)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE articles SET content_html = ?, toc = ?, render_version = ? WHERE id = ?`
+	_, err = (*r).db.Exec(query, (*article).ContentHTML, string(toc), (*article).RenderVersion, (*article).ID)
+	return err
+}
+
+func (r *SQLiteRepository) SetArticleStatus(id int, status domain.ArticleStatus, publishedAt *time.Time) error {
+	query := `UPDATE articles SET status = ?, published_at = ?, publish_at = NULL,
+		unpublish_at = CASE WHEN ? = 'published' THEN unpublish_at END,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, status, nullableTime(publishedAt), status, id)
+	return err
+}
+
+func (r *SQLiteRepository) SetArticleSchedule(id int, publishAt, unpublishAt *time.Time, scheduledBy int) error {
+	query := `UPDATE articles SET publish_at = ?, unpublish_at = ?, scheduled_by = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, nullableTime(publishAt), nullableTime(unpublishAt), nullableID(scheduledBy), id)
 	return err
 }
 
+// GetScheduledArticles returns the matching articles with a pending
+// publish_at or unpublish_at.
+func (r *SQLiteRepository) GetScheduledArticles(query domain.ArticleQuery) ([]*domain.Article, error) {
+	sqlQuery := `SELECT ` + articleColumns + ` FROM articles
+		WHERE (publish_at IS NOT NULL OR unpublish_at IS NOT NULL) AND (? = 0 OR author_id = ?)`
+	rows, err := (*r).db.Query(sqlQuery, query.AuthorID, query.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []*domain.Article
+	for rows.Next() {
+		article, err := scanArticle(rows)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+
+	return articles, rows.Err()
+}
+
+// PublishDueArticles publishes every article whose publish_at has passed and
+// returns them. Each article is claimed with a conditional update, so when
+// several servers share the database only one of them returns it.
+func (r *SQLiteRepository) PublishDueArticles(now time.Time) ([]*domain.Article, error) {
+	due := `SELECT id FROM articles WHERE publish_at <= ?`
+	claim := `UPDATE articles SET status = 'published', published_at = COALESCE(published_at, ?),
+		publish_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND publish_at IS NOT NULL AND publish_at <= ?`
+
+	at := dbTime(now)
+	return (*r).transitionDueArticles(due, at, func(id int) (sql.Result, error) {
+		return (*r).db.Exec(claim, at, id, at)
+	})
+}
+
+// UnpublishDueArticles turns published articles whose unpublish_at has passed
+// back into drafts, claiming them like PublishDueArticles.
+func (r *SQLiteRepository) UnpublishDueArticles(now time.Time) ([]*domain.Article, error) {
+	due := `SELECT id FROM articles WHERE status = 'published' AND unpublish_at <= ?`
+	claim := `UPDATE articles SET status = 'draft', published_at = NULL,
+		unpublish_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = 'published' AND unpublish_at IS NOT NULL AND unpublish_at <= ?`
+
+	at := dbTime(now)
+	return (*r).transitionDueArticles(due, at, func(id int) (sql.Result, error) {
+		return (*r).db.Exec(claim, id, at)
+	})
+}
+
 func (r *SQLiteRepository) DeleteArticle(id int) error {
 	query := `DELETE FROM articles WHERE id = ?`
 	_, err := (*r).db.Exec(query, id)
 	return err
 }
 
+// -- search --
+
+// matchStart and matchEnd surround matches in highlights and snippets until
+// they are turned into HTML.
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+// SearchAvailable is false when the SQLite driver was built without FTS5.
+func (r *SQLiteRepository) SearchAvailable() (bool, error) {
+	var available bool
+	err := (*r).db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')
+		AND EXISTS (SELECT 1 FROM sqlite_master WHERE name = 'articles_fts')`).Scan(&available)
+	return available, err
+}
+
+// SearchArticles ranks matches with bm25, counting title matches ten times
+// as much as content matches.
+func (r *SQLiteRepository) SearchArticles(query domain.SearchQuery) ([]*domain.SearchResult, int, error) {
+	match := matchExpression(query.Text)
+	if match == "" {
+		return []*domain.SearchResult{}, 0, nil
+	}
+
+	conditions, args := articleConditions(domain.ArticleQuery{
+		Status: query.Status,
+		Author: query.Author,
+		Tag:    query.Tag,
+	}, "")
+	conditions = append([]string{"articles_fts MATCH ?"}, conditions...)
+	args = append([]any{match}, args...)
+	from := ` FROM articles_fts JOIN articles ON articles.id = articles_fts.rowid` + whereClause(conditions)
+
+	var total int
+	if err := (*r).db.QueryRow(`SELECT COUNT(*)`+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	sqlQuery := `SELECT articles.id, articles.slug, highlight(articles_fts, 0, ?, ?),
+		snippet(articles_fts, 1, ?, ?, '…', 24), articles.author, articles.published_at,
+		bm25(articles_fts, 10.0, 1.0) AS score` + from + ` ORDER BY score, articles.id LIMIT ? OFFSET ?`
+	args = append([]any{matchStart, matchEnd, matchStart, matchEnd}, args...)
+	rows, err := (*r).db.Query(sqlQuery, append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []*domain.SearchResult{}
+	for rows.Next() {
+		var result domain.SearchResult
+		var slug sql.NullString
+		var publishedAt sql.NullTime
+		var bm25 float64
+		if err := rows.Scan(&result.ArticleID, &slug, &result.Title, &result.Snippet, &result.Author, &publishedAt, &bm25); err != nil {
+			return nil, 0, err
+		}
+
+		result.Slug = slug.String
+		result.Title = markMatches(result.Title)
+		result.Snippet = markMatches(result.Snippet)
+		if publishedAt.Valid {
+			result.PublishedAt = &publishedAt.Time
+		}
+		// bm25 is lower for better matches
+		result.Score = -bm25
+		results = append(results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]int, len(results))
+	for i, result := range results {
+		ids[i] = result.ArticleID
+	}
+	tags, err := (*r).tagsByArticle(ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, result := range results {
+		result.Tags = tags[result.ArticleID]
+	}
+
+	return results, total, nil
+}
+
+// -- article revisions --
+func (r *SQLiteRepository) CreateArticleRevision(revision *domain.ArticleRevision) error {
+	tags, err := json.Marshal((*revision).Tags)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO article_revisions (article_id, revision, title, content, tags, author_id, author_name, created_at)
+		SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?, ?, ? FROM article_revisions WHERE article_id = ?`
+	result, err := (*r).db.Exec(query,
+		(*revision).ArticleID,
+		(*revision).Title,
+		(*revision).Content,
+		string(tags),
+		nullableID((*revision).AuthorID),
+		(*revision).AuthorName,
+		(*revision).CreatedAt.UTC(),
+		(*revision).ArticleID)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	(*revision).ID = int(id)
+
+	return (*r).db.QueryRow(`SELECT revision FROM article_revisions WHERE id = ?`, id).Scan(&(*revision).Revision)
+}
+
+func (r *SQLiteRepository) GetArticleRevisions(articleID int) ([]*domain.ArticleRevision, error) {
+	query := `SELECT id, article_id, revision, title, '', tags, author_id, author_name, created_at
+		FROM article_revisions WHERE article_id = ? ORDER BY revision DESC`
+	rows, err := (*r).db.Query(query, articleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*domain.ArticleRevision
+	for rows.Next() {
+		revision, err := scanArticleRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (r *SQLiteRepository) GetArticleRevision(articleID, revision int) (*domain.ArticleRevision, error) {
+	query := `SELECT id, article_id, revision, title, content, tags, author_id, author_name, created_at
+		FROM article_revisions WHERE article_id = ? AND revision = ?`
+	return scanArticleRevision((*r).db.QueryRow(query, articleID, revision))
+}
+
 // -- comments --
 func (r *SQLiteRepository) CreateComment(comment *domain.Comment) error {
 	query := `INSERT INTO comments (article_id, author, content) VALUES (?, ?, ?)`
@@ -110,6 +514,24 @@ func (r *SQLiteRepository) CreateComment(comment *domain.Comment) error {
 	return nil
 }
 
+func (r *SQLiteRepository) GetComment(id int) (*domain.Comment, error) {
+	query := `SELECT id, article_id, author, content, created_at FROM comments WHERE id = ?`
+	row := (*r).db.QueryRow(query, id)
+
+	var comment domain.Comment
+	err := row.Scan(
+		&comment.ID,
+		&comment.ArticleID,
+		&comment.Author,
+		&comment.Content,
+		&comment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
 func (r *SQLiteRepository) GetCommentsByArticleID(articleID int) ([]*domain.Comment, error) {
 	query := `SELECT id, article_id, author, content, created_at FROM comments WHERE article_id = ? ORDER BY created_at ASC`
 	rows, err := (*r).db.Query(query, articleID)
@@ -159,6 +581,37 @@ func (r *SQLiteRepository) CreateTag(tag *domain.Tag) error {
 	return nil
 }
 
+// UpsertTag returns the tag called name, creating it when there is none.
+func (r *SQLiteRepository) UpsertTag(name string) (*domain.Tag, error) {
+	// the no-op update makes RETURNING give the existing row
+	query := `INSERT INTO tags (name) VALUES (?)
+		ON CONFLICT (name) DO UPDATE SET name = excluded.name
+		RETURNING id, name`
+	var tag domain.Tag
+	if err := (*r).db.QueryRow(query, name).Scan(&tag.ID, &tag.Name); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (r *SQLiteRepository) GetTag(id int) (*domain.Tag, error) {
+	var tag domain.Tag
+	err := (*r).db.QueryRow(`SELECT id, name FROM tags WHERE id = ?`, id).Scan(&tag.ID, &tag.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (r *SQLiteRepository) GetTagByName(name string) (*domain.Tag, error) {
+	var tag domain.Tag
+	err := (*r).db.QueryRow(`SELECT id, name FROM tags WHERE name = ?`, name).Scan(&tag.ID, &tag.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
 func (r *SQLiteRepository) GetAllTags() ([]*domain.Tag, error) {
 	query := `SELECT id, name FROM tags ORDER BY name`
 	rows, err := (*r).db.Query(query)
@@ -180,6 +633,51 @@ func (r *SQLiteRepository) GetAllTags() ([]*domain.Tag, error) {
 	return tags, nil
 }
 
+// GetTagUsage returns every tag by name, including unused ones.
+func (r *SQLiteRepository) GetTagUsage() ([]*domain.TagUsage, error) {
+	query := `SELECT t.id, t.name, COUNT(a.id) FROM tags t
+		LEFT JOIN article_tags at ON at.tag_id = t.id
+		LEFT JOIN articles a ON a.id = at.article_id AND a.status = 'published'
+		GROUP BY t.id ORDER BY t.name`
+	rows, err := (*r).db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []*domain.TagUsage{}
+	for rows.Next() {
+		var tag domain.TagUsage
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.ArticleCount); err != nil {
+			return nil, err
+		}
+		usage = append(usage, &tag)
+	}
+
+	return usage, rows.Err()
+}
+
+func (r *SQLiteRepository) RenameTag(id int, name string) error {
+	_, err := (*r).db.Exec(`UPDATE tags SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+func (r *SQLiteRepository) MergeTags(sourceID, targetID int) error {
+	return (*r).execAll([]statement{
+		{`INSERT OR IGNORE INTO article_tags (article_id, tag_id) SELECT article_id, ? FROM article_tags WHERE tag_id = ?`, []any{targetID, sourceID}},
+		{`DELETE FROM article_tags WHERE tag_id = ?`, []any{sourceID}},
+		{`DELETE FROM tags WHERE id = ?`, []any{sourceID}},
+	})
+}
+
+// DeleteTag also removes the tag from its articles.
+func (r *SQLiteRepository) DeleteTag(id int) error {
+	return (*r).execAll([]statement{
+		{`DELETE FROM article_tags WHERE tag_id = ?`, []any{id}},
+		{`DELETE FROM tags WHERE id = ?`, []any{id}},
+	})
+}
+
 func (r *SQLiteRepository) GetTagsByArticleID(articleID int) ([]*domain.Tag, error) {
 	query := `SELECT t.id, t.name FROM tags t 
 		JOIN article_tags at ON t.id = at.tag_id 
@@ -203,6 +701,58 @@ func (r *SQLiteRepository) GetTagsByArticleID(articleID int) ([]*domain.Tag, err
 	return tags, nil
 }
 
+// loadTags sets the tags of all articles, loading them in batches instead of
+// one query per article.
+func (r *SQLiteRepository) loadTags(articles []*domain.Article) error {
+	ids := make([]int, len(articles))
+	for i, article := range articles {
+		ids[i] = article.ID
+	}
+
+	tags, err := (*r).tagsByArticle(ids)
+	if err != nil {
+		return err
+	}
+	for _, article := range articles {
+		article.Tags = tags[article.ID]
+	}
+	return nil
+}
+
+// tagsByArticle returns the tags of the given articles by article id.
+func (r *SQLiteRepository) tagsByArticle(ids []int) (map[int][]*domain.Tag, error) {
+	tags := make(map[int][]*domain.Tag, len(ids))
+	for batch := range slices.Chunk(ids, tagBatchSize) {
+		query := `SELECT at.article_id, t.id, t.name FROM article_tags at
+			JOIN tags t ON t.id = at.tag_id
+			WHERE at.article_id IN (` + placeholders(len(batch)) + `)
+			ORDER BY at.article_id, t.id`
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		rows, err := (*r).db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var articleID int
+			var tag domain.Tag
+			if err := rows.Scan(&articleID, &tag.ID, &tag.Name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			tags[articleID] = append(tags[articleID], &tag)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
 func (r *SQLiteRepository) AddTagToArticle(articleID int, tagID int) error {
 	query := `INSERT OR IGNORE INTO article_tags (article_id, tag_id) VALUES (?, ?)`
 	_, err := (*r).db.Exec(query, articleID, tagID)
@@ -214,3 +764,722 @@ func (r *SQLiteRepository) RemoveTagFromArticle(articleID int, tagID int) error
 	_, err := (*r).db.Exec(query, articleID, tagID)
 	return err
 }
+
+// -- users --
+func (r *SQLiteRepository) CreateUser(user *domain.User) error {
+	query := `INSERT INTO users (username, email, oidc_subject, sso_managed, password_hash, role) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := (*r).db.Exec(query,
+		(*user).Username,
+		nullableString((*user).Email),
+		nullableString((*user).OIDCSubject),
+		(*user).SSOManaged,
+		(*user).PasswordHash,
+		(*user).Role)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	(*user).ID = int(id)
+	return nil
+}
+
+func (r *SQLiteRepository) GetUser(id int) (*domain.User, error) {
+	query := `SELECT id, username, email, oidc_subject, sso_managed, password_hash, role, disabled, totp_enabled, totp_secret, totp_last_step, created_at, updated_at FROM users WHERE id = ?`
+	return scanUser((*r).db.QueryRow(query, id))
+}
+
+func (r *SQLiteRepository) GetUserByUsername(username string) (*domain.User, error) {
+	query := `SELECT id, username, email, oidc_subject, sso_managed, password_hash, role, disabled, totp_enabled, totp_secret, totp_last_step, created_at, updated_at FROM users WHERE username = ?`
+	return scanUser((*r).db.QueryRow(query, username))
+}
+
+func (r *SQLiteRepository) GetUserByEmail(email string) (*domain.User, error) {
+	query := `SELECT id, username, email, oidc_subject, sso_managed, password_hash, role, disabled, totp_enabled, totp_secret, totp_last_step, created_at, updated_at FROM users WHERE email = ?`
+	return scanUser((*r).db.QueryRow(query, email))
+}
+
+func (r *SQLiteRepository) GetUserByOIDCSubject(subject string) (*domain.User, error) {
+	query := `SELECT id, username, email, oidc_subject, sso_managed, password_hash, role, disabled, totp_enabled, totp_secret, totp_last_step, created_at, updated_at FROM users WHERE oidc_subject = ?`
+	return scanUser((*r).db.QueryRow(query, subject))
+}
+
+func (r *SQLiteRepository) GetAllUsers() ([]*domain.User, error) {
+	query := `SELECT id, username, email, oidc_subject, sso_managed, password_hash, role, disabled, totp_enabled, totp_secret, totp_last_step, created_at, updated_at FROM users ORDER BY username`
+	rows, err := (*r).db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *SQLiteRepository) CountUsers() (int, error) {
+	var count int
+	err := (*r).db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count)
+	return count, err
+}
+
+func (r *SQLiteRepository) SetUserDisabled(id int, disabled bool) error {
+	query := `UPDATE users SET disabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, disabled, id)
+	return err
+}
+
+func (r *SQLiteRepository) SetUserRole(id int, role domain.Role) error {
+	query := `UPDATE users SET role = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, role, id)
+	return err
+}
+
+func (r *SQLiteRepository) SetPasswordHash(id int, passwordHash string) error {
+	query := `UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, passwordHash, id)
+	return err
+}
+
+func (r *SQLiteRepository) SetUserEmail(id int, email string) error {
+	query := `UPDATE users SET email = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, nullableString(email), id)
+	return err
+}
+
+func (r *SQLiteRepository) LinkOIDCSubject(id int, subject, email string) error {
+	query := `UPDATE users SET oidc_subject = ?, email = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, subject, nullableString(email), id)
+	return err
+}
+
+func (r *SQLiteRepository) DeleteUser(id int) error {
+	query := `DELETE FROM users WHERE id = ?`
+	_, err := (*r).db.Exec(query, id)
+	return err
+}
+
+func (r *SQLiteRepository) SetTOTPSecret(userID int, secret string) error {
+	query := `UPDATE users SET totp_secret = ?, totp_enabled = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, secret, userID)
+	return err
+}
+
+func (r *SQLiteRepository) EnableTOTP(userID int) error {
+	query := `UPDATE users SET totp_enabled = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := (*r).db.Exec(query, userID)
+	return err
+}
+
+func (r *SQLiteRepository) DisableTOTP(userID int) error {
+	return (*r).execAll([]statement{
+		{`UPDATE users SET totp_secret = '', totp_enabled = 0, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, []any{userID}},
+		{`DELETE FROM recovery_codes WHERE user_id = ?`, []any{userID}},
+	})
+}
+
+func (r *SQLiteRepository) AdvanceTOTPStep(userID int, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`
+	result, err := (*r).db.Exec(query, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (r *SQLiteRepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	statements := []statement{{`DELETE FROM recovery_codes WHERE user_id = ?`, []any{userID}}}
+	for _, hash := range codeHashes {
+		statements = append(statements, statement{`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, []any{userID, hash}})
+	}
+	return (*r).execAll(statements)
+}
+
+func (r *SQLiteRepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+	result, err := (*r).db.Exec(query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// -- api tokens --
+func (r *SQLiteRepository) CreateAPIToken(token *domain.APIToken) error {
+	query := `INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := (*r).db.Exec(query,
+		(*token).UserID,
+		(*token).Name,
+		(*token).TokenHash,
+		strings.Join((*token).Scopes, " "),
+		(*token).ExpiresAt.UTC(),
+		(*token).CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	(*token).ID = int(id)
+	return nil
+}
+
+func (r *SQLiteRepository) GetAPITokenByHash(tokenHash string) (*domain.APIToken, error) {
+	query := `SELECT id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at FROM api_tokens WHERE token_hash = ?`
+	return scanAPIToken((*r).db.QueryRow(query, tokenHash))
+}
+
+func (r *SQLiteRepository) GetAPITokensByUserID(userID int) ([]*domain.APIToken, error) {
+	query := `SELECT id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at FROM api_tokens
+		WHERE user_id = ? ORDER BY created_at DESC`
+	rows, err := (*r).db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*domain.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (r *SQLiteRepository) TouchAPIToken(id int, lastUsed time.Time) error {
+	_, err := (*r).db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, lastUsed.UTC(), id)
+	return err
+}
+
+func (r *SQLiteRepository) DeleteAPIToken(userID int, id int) (bool, error) {
+	result, err := (*r).db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// -- one-time tokens --
+func (r *SQLiteRepository) CreateOneTimeToken(tokenHash string, userID int, purpose string, expiresAt, createdAt time.Time) error {
+	query := `INSERT INTO one_time_tokens (token_hash, user_id, purpose, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := (*r).db.Exec(query, tokenHash, userID, purpose, expiresAt.UTC(), createdAt.UTC())
+	return err
+}
+
+func (r *SQLiteRepository) ConsumeOneTimeToken(tokenHash, purpose string, now time.Time) (bool, error) {
+	query := `DELETE FROM one_time_tokens WHERE token_hash = ? AND purpose = ? AND expires_at > ?`
+	result, err := (*r).db.Exec(query, tokenHash, purpose, now.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *SQLiteRepository) CountOneTimeTokenAttempt(tokenHash, purpose string, now time.Time, maxAttempts int) (bool, error) {
+	query := `UPDATE one_time_tokens SET attempts = attempts + 1
+		WHERE token_hash = ? AND purpose = ? AND expires_at > ? AND attempts < ?`
+	result, err := (*r).db.Exec(query, tokenHash, purpose, now.UTC(), maxAttempts)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *SQLiteRepository) CountOneTimeTokensSince(userID int, purpose string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM one_time_tokens WHERE user_id = ? AND purpose = ? AND created_at > ?`
+	var count int
+	err := (*r).db.QueryRow(query, userID, purpose, since.UTC()).Scan(&count)
+	return count, err
+}
+
+func (r *SQLiteRepository) DeleteOneTimeTokens(userID int, purpose string) error {
+	_, err := (*r).db.Exec(`DELETE FROM one_time_tokens WHERE user_id = ? AND purpose = ?`, userID, purpose)
+	return err
+}
+
+func (r *SQLiteRepository) DeleteExpiredOneTimeTokens(now time.Time) error {
+	_, err := (*r).db.Exec(`DELETE FROM one_time_tokens WHERE expires_at <= ?`, now.UTC())
+	return err
+}
+
+// -- audit events --
+func (r *SQLiteRepository) CreateAuditEvent(event *domain.AuditEvent) error {
+	query := `INSERT INTO audit_events (actor_id, actor_name, ip, action, target_type, target_id, before, after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := (*r).db.Exec(query,
+		nullableID((*event).ActorID),
+		(*event).ActorName,
+		(*event).IP,
+		(*event).Action,
+		(*event).TargetType,
+		(*event).TargetID,
+		(*event).Before,
+		(*event).After,
+		(*event).CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	(*event).ID = int(id)
+	return nil
+}
+
+func (r *SQLiteRepository) GetAuditEvents(filter domain.AuditFilter) ([]*domain.AuditEvent, error) {
+	where, args := auditWhere(filter)
+	query := `SELECT id, actor_id, actor_name, ip, action, target_type, target_id, before, after, created_at FROM audit_events` +
+		where + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := (*r).db.Query(query, append(args, limit, filter.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *SQLiteRepository) CountAuditEvents(filter domain.AuditFilter) (int, error) {
+	where, args := auditWhere(filter)
+	var count int
+	err := (*r).db.QueryRow(`SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&count)
+	return count, err
+}
+
+func (r *SQLiteRepository) EachAuditEvent(filter domain.AuditFilter, fn func(*domain.AuditEvent) error) error {
+	where, args := auditWhere(filter)
+	query := `SELECT id, actor_id, actor_name, ip, action, target_type, target_id, before, after, created_at FROM audit_events` +
+		where + ` ORDER BY id DESC`
+	rows, err := (*r).db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// -- helpers --
+
+// transitionDueArticles calls claim for every article selected by the due
+// query and returns the ones it changed.
+func (r *SQLiteRepository) transitionDueArticles(due, now string, claim func(id int) (sql.Result, error)) ([]*domain.Article, error) {
+	rows, err := (*r).db.Query(due, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var articles []*domain.Article
+	for _, id := range ids {
+		result, err := claim(id)
+		if err != nil {
+			return articles, err
+		}
+		// another server got there first
+		if changed, err := result.RowsAffected(); err != nil || changed == 0 {
+			continue
+		}
+
+		article, err := (*r).GetArticle(id)
+		if err != nil {
+			return articles, err
+		}
+		articles = append(articles, article)
+	}
+
+	return articles, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanArticle reads the articleColumns, followed by any extra columns.
+func scanArticle(row rowScanner, extra ...any) (*domain.Article, error) {
+	var article domain.Article
+	var authorID, scheduledBy sql.NullInt64
+	var slug sql.NullString
+	var toc string
+	var publishedAt, publishAt, unpublishAt sql.NullTime
+	dest := []any{
+		&article.ID,
+		&article.Title,
+		&slug,
+		&article.Content,
+		&article.ContentHTML,
+		&toc,
+		&article.RenderVersion,
+		&article.Author,
+		&authorID,
+		&article.Status,
+		&publishedAt,
+		&publishAt,
+		&unpublishAt,
+		&scheduledBy,
+		&article.CreatedAt,
+		&article.UpdatedAt,
+		&article.CommentCount,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(toc), &article.TOC); err != nil {
+		return nil, err
+	}
+	article.Slug = slug.String
+	article.AuthorID = int(authorID.Int64)
+	article.ScheduledBy = int(scheduledBy.Int64)
+	if publishedAt.Valid {
+		article.PublishedAt = &publishedAt.Time
+	}
+	if publishAt.Valid {
+		article.PublishAt = &publishAt.Time
+	}
+	if unpublishAt.Valid {
+		article.UnpublishAt = &unpublishAt.Time
+	}
+	return &article, nil
+}
+
+func scanArticleRevision(row rowScanner) (*domain.ArticleRevision, error) {
+	var revision domain.ArticleRevision
+	var tags string
+	var authorID sql.NullInt64
+	err := row.Scan(
+		&revision.ID,
+		&revision.ArticleID,
+		&revision.Revision,
+		&revision.Title,
+		&revision.Content,
+		&tags,
+		&authorID,
+		&revision.AuthorName,
+		&revision.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(tags), &revision.Tags); err != nil {
+		return nil, err
+	}
+	revision.AuthorID = int(authorID.Int64)
+	return &revision, nil
+}
+
+func scanUser(row rowScanner) (*domain.User, error) {
+	var user domain.User
+	var email, subject sql.NullString
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&email,
+		&subject,
+		&user.SSOManaged,
+		&user.PasswordHash,
+		&user.Role,
+		&user.Disabled,
+		&user.TOTPEnabled,
+		&user.TOTPSecret,
+		&user.TOTPLastStep,
+		&user.CreatedAt,
+		&user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Email = email.String
+	user.OIDCSubject = subject.String
+	return &user, nil
+}
+
+func scanAPIToken(row rowScanner) (*domain.APIToken, error) {
+	var token domain.APIToken
+	var scopes string
+	var lastUsed sql.NullTime
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenHash,
+		&scopes,
+		&token.ExpiresAt,
+		&lastUsed,
+		&token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	if lastUsed.Valid {
+		token.LastUsedAt = &lastUsed.Time
+	}
+	return &token, nil
+}
+
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+func scanAuditEvent(row rowScanner) (*domain.AuditEvent, error) {
+	var event domain.AuditEvent
+	var actorID sql.NullInt64
+	err := row.Scan(
+		&event.ID,
+		&actorID,
+		&event.ActorName,
+		&event.IP,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&event.Before,
+		&event.After,
+		&event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	event.ActorID = int(actorID.Int64)
+	return &event, nil
+}
+
+// statement is a query and its arguments, for execAll.
+type statement struct {
+	query string
+	args  []any
+}
+
+// execAll runs statements in one transaction.
+func (r *SQLiteRepository) execAll(statements []statement) error {
+	return (*r).transaction(func(tx *SQLiteRepository) error {
+		for _, st := range statements {
+			if _, err := (*tx).db.Exec(st.query, st.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// articleConditions applies the filters of query, with the date range on
+// dateKey. Columns are those of the articles table.
+func articleConditions(query domain.ArticleQuery, dateKey string) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	if query.Status != "" {
+		conditions = append(conditions, `status = ?`)
+		args = append(args, query.Status)
+	}
+	if query.AuthorID != 0 {
+		conditions = append(conditions, `author_id = ?`)
+		args = append(args, query.AuthorID)
+	}
+	if query.Author != "" {
+		conditions = append(conditions, `author = ? COLLATE NOCASE`)
+		args = append(args, query.Author)
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM article_tags at JOIN tags t ON t.id = at.tag_id
+			WHERE at.article_id = articles.id AND t.name = ?)`)
+		args = append(args, query.Tag)
+	}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, dateKey+` >= ?`)
+		args = append(args, dbTime(query.Since))
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, dateKey+` < ?`)
+		args = append(args, dbTime(query.Until))
+	}
+
+	return conditions, args
+}
+
+// placeholders returns "?, ?, ?" for n parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// auditWhere builds the WHERE clause for the filter's conditions.
+func auditWhere(filter domain.AuditFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if action, isPrefix := strings.CutSuffix(filter.Action, "*"); isPrefix {
+		conditions = append(conditions, `action LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(action)+"%")
+	} else if filter.Action != "" {
+		conditions = append(conditions, `action = ?`)
+		args = append(args, filter.Action)
+	}
+	if filter.ActorID != 0 {
+		conditions = append(conditions, `actor_id = ?`)
+		args = append(args, filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, `target_type = ?`)
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, `target_id = ?`)
+		args = append(args, filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, `created_at >= ?`)
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, `created_at < ?`)
+		args = append(args, filter.Until.UTC())
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// matchExpression turns a search into an FTS5 query that cannot have
+// syntax errors. Words and "quoted phrases" must all match, and a trailing *
+// matches by prefix.
+func matchExpression(text string) string {
+	var terms []string
+	for text != "" {
+		var term string
+		if rest, ok := strings.CutPrefix(text, `"`); ok {
+			end := strings.IndexByte(rest, '"')
+			if end < 0 {
+				end = len(rest)
+			}
+			term, text = rest[:end], strings.TrimPrefix(rest[end:], `"`)
+		} else {
+			end := strings.IndexAny(text, " \t\r\n\"")
+			if end < 0 {
+				end = len(text)
+			}
+			term, text = text[:end], text[end:]
+		}
+
+		prefix := strings.HasPrefix(text, "*") || strings.HasSuffix(term, "*")
+		text = strings.TrimLeft(text, "* \t\r\n")
+		term = strings.TrimSpace(strings.TrimRight(term, "*"))
+		if term == "" {
+			continue
+		}
+
+		term = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+// markMatches escapes text for HTML and puts the matches in <mark> elements.
+func markMatches(text string) string {
+	replacer := strings.NewReplacer(matchStart, "<mark>", matchEnd, "</mark>")
+	return replacer.Replace(html.EscapeString(text))
+}
+
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
+
+func nullableString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullableTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: dbTime(*t), Valid: true}
+}
+
+// dbTime formats t the way SQLite's CURRENT_TIMESTAMP does. Article dates
+// are stored and compared in this format only, mixing it with the driver's
+// "+00:00" times would compare them wrongly as text.
+func dbTime(t time.Time) string {
+	return t.UTC().Format(time.DateTime)
+}
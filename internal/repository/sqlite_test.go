@@ -0,0 +1,424 @@
+package repository
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"blog-system/internal/domain"
+	"blog-system/pkg/database"
+)
+
+const (
+	seedArticles = 3000
+	seedTags     = 50
+)
+
+// newRepository returns a repository on a fresh database file at path.
+func newRepository(tb testing.TB, path string) *SQLiteRepository {
+	tb.Helper()
+
+	db, err := database.NewSQLiteDB(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	return NewSQLiteRepository(db)
+}
+
+// newSeededRepository returns a repository on a fresh database file with
+// seedArticles published articles, each with three tags and a few comments.
+func newSeededRepository(tb testing.TB) *SQLiteRepository {
+	tb.Helper()
+
+	repo := newRepository(tb, filepath.Join(tb.TempDir(), "blog.db"))
+	err := (*repo).transaction(func(tx *SQLiteRepository) error {
+		var err error
+		tags := make([]*domain.Tag, seedTags)
+		for i := range tags {
+			if tags[i], err = (*tx).UpsertTag(fmt.Sprintf("tag-%d", i)); err != nil {
+				return err
+			}
+		}
+
+		for i := range seedArticles {
+			article := &domain.Article{
+				Title:   fmt.Sprintf("Article %d", i),
+				Slug:    fmt.Sprintf("article-%d", i),
+				Content: "Some content",
+				Author:  "author",
+				Status:  domain.ArticlePublished,
+			}
+			if err := (*tx).CreateArticle(article); err != nil {
+				return err
+			}
+
+			for j := range 3 {
+				if err := (*tx).AddTagToArticle(article.ID, tags[(i+j*7)%seedTags].ID); err != nil {
+					return err
+				}
+			}
+			for j := range i % 5 {
+				comment := &domain.Comment{ArticleID: article.ID, Author: "reader", Content: fmt.Sprintf("Comment %d", j)}
+				if err := (*tx).CreateComment(comment); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return repo
+}
+
+func TestGetArticle(t *testing.T) {
+	repo := newSeededRepository(t)
+
+	article, err := (*repo).GetArticle(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "Article 7" || len(article.Tags) != 3 || article.CommentCount != 2 {
+		t.Errorf("article = %q with %d tags and %d comments, want %q with 3 tags and 2 comments",
+			article.Title, len(article.Tags), article.CommentCount, "Article 7")
+	}
+
+	bySlug, err := (*repo).GetArticleBySlug("article-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bySlug.ID != article.ID || len(bySlug.Tags) != 3 || bySlug.CommentCount != 2 {
+		t.Errorf("by slug = %+v, want the article with id %d", bySlug, article.ID)
+	}
+}
+
+func TestListArticlesLoadsTagsAndCommentCounts(t *testing.T) {
+	repo := newSeededRepository(t)
+
+	page, err := (*repo).ListArticles(domain.ArticleQuery{Sort: domain.SortCreated, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != seedArticles || len(page.Articles) != 100 {
+		t.Fatalf("got %d of %d articles, want 100 of %d", len(page.Articles), page.Total, seedArticles)
+	}
+
+	for _, article := range page.Articles {
+		tags, err := (*repo).GetTagsByArticleID(article.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		comments, err := (*repo).GetCommentsByArticleID(article.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(article.Tags) != len(tags) || article.CommentCount != len(comments) {
+			t.Errorf("article %d has %d tags and %d comments, want %d and %d",
+				article.ID, len(article.Tags), article.CommentCount, len(tags), len(comments))
+		}
+	}
+}
+
+// BenchmarkListArticles compares loading a page of articles with batched
+// tags against loading the tags and comments of each article separately, as
+// the repository used to.
+func BenchmarkListArticles(b *testing.B) {
+	repo := newSeededRepository(b)
+
+	for _, limit := range []int{20, 100} {
+		query := domain.ArticleQuery{Sort: domain.SortPublished, Limit: limit}
+
+		b.Run(fmt.Sprintf("batched/%d", limit), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := (*repo).ListArticles(query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("per_article/%d", limit), func(b *testing.B) {
+			for b.Loop() {
+				page, err := (*repo).listArticlesPerArticle(query)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, article := range page {
+					if article.Tags, err = (*repo).GetTagsByArticleID(article.ID); err != nil {
+						b.Fatal(err)
+					}
+					comments, err := (*repo).GetCommentsByArticleID(article.ID)
+					if err != nil {
+						b.Fatal(err)
+					}
+					article.CommentCount = len(comments)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetArticle compares GetArticle against the article, tags and
+// comments queries it used to run.
+func BenchmarkGetArticle(b *testing.B) {
+	repo := newSeededRepository(b)
+
+	b.Run("batched", func(b *testing.B) {
+		id := 0
+		for b.Loop() {
+			id = id%seedArticles + 1
+			if _, err := (*repo).GetArticle(id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("per_article", func(b *testing.B) {
+		id := 0
+		for b.Loop() {
+			id = id%seedArticles + 1
+			article, err := scanArticle((*repo).db.QueryRow(`SELECT `+articleColumns+` FROM articles WHERE id = ?`, id))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if article.Tags, err = (*repo).GetTagsByArticleID(id); err != nil {
+				b.Fatal(err)
+			}
+			if article.Comments, err = (*repo).GetCommentsByArticleID(id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// listArticlesPerArticle reads a page of articles without their tags.
+func (r *SQLiteRepository) listArticlesPerArticle(query domain.ArticleQuery) ([]*domain.Article, error) {
+	rows, err := (*r).db.Query(`SELECT `+articleColumns+` FROM articles
+		ORDER BY COALESCE(published_at, created_at) DESC, id DESC LIMIT ?`, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []*domain.Article
+	for rows.Next() {
+		article, err := scanArticle(rows)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, rows.Err()
+}
+
+func TestDeleteArticleCascades(t *testing.T) {
+	repo := newSeededRepository(t)
+	const id = 8
+
+	if err := (*repo).SetArticleSlug(id, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	err := (*repo).CreateArticleRevision(&domain.ArticleRevision{ArticleID: id, Title: "Article 7", Content: "Some content", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (*repo).DeleteArticle(id); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"comments", "article_slugs", "article_revisions", "article_tags"} {
+		if count := countRows(t, repo, table, "article_id", id); count != 0 {
+			t.Errorf("%d %s rows of the deleted article are left", count, table)
+		}
+	}
+}
+
+func TestDeleteArticleReleasesSlugs(t *testing.T) {
+	repo := newSeededRepository(t)
+	const id = 8
+
+	if err := (*repo).SetArticleSlug(id, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if articleID, err := (*repo).GetArticleIDByOldSlug("article-7"); err != nil || articleID != id {
+		t.Fatalf("old slug redirects to %d (%v), want %d", articleID, err, id)
+	}
+
+	if err := (*repo).DeleteArticle(id); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, slug := range []string{"article-7", "renamed"} {
+		if taken, err := (*repo).IsSlugTaken(slug, 0); err != nil || taken {
+			t.Errorf("slug %q is still taken (%v)", slug, err)
+		}
+	}
+	if articleID, err := (*repo).GetArticleIDByOldSlug("article-7"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("old slug redirects to deleted article %d (%v)", articleID, err)
+	}
+}
+
+func TestDeleteUserCascades(t *testing.T) {
+	repo := newSeededRepository(t)
+
+	user := &domain.User{Username: "jane", PasswordHash: "hash", Role: domain.RoleAuthor}
+	if err := (*repo).CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	article := &domain.Article{Title: "Jane's", Content: "Content", Author: "jane", AuthorID: user.ID, Status: domain.ArticleDraft}
+	if err := (*repo).CreateArticle(article); err != nil {
+		t.Fatal(err)
+	}
+	if err := (*repo).ReplaceRecoveryCodes(user.ID, []string{"code-hash"}); err != nil {
+		t.Fatal(err)
+	}
+	token := &domain.APIToken{UserID: user.ID, Name: "ci", TokenHash: "token-hash", Scopes: []string{"articles:write"}, ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+	if err := (*repo).CreateAPIToken(token); err != nil {
+		t.Fatal(err)
+	}
+	if err := (*repo).CreateOneTimeToken("one-time-hash", user.ID, "magic_link", now.Add(time.Hour), now); err != nil {
+		t.Fatal(err)
+	}
+	_, err := (*repo).db.Exec(`INSERT INTO sessions (id, user_id, created_at, expires_at) VALUES ('session', ?, ?, ?)`, user.ID, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (*repo).DeleteUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"sessions", "recovery_codes", "api_tokens", "one_time_tokens"} {
+		if count := countRows(t, repo, table, "user_id", user.ID); count != 0 {
+			t.Errorf("%d %s rows of the deleted user are left", count, table)
+		}
+	}
+
+	// articles stay, without their author
+	kept, err := (*repo).GetArticle(article.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.AuthorID != 0 {
+		t.Errorf("AuthorID = %d, want 0", kept.AuthorID)
+	}
+}
+
+func countRows(t *testing.T, repo *SQLiteRepository, table, column string, id int) int {
+	t.Helper()
+
+	var count int
+	if err := (*repo).db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+column+` = ?`, id).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestListArticlesDateRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blog.db")
+	repo := newRepository(t, path)
+	noon := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	create := func(title string, publishedAt time.Time) *domain.Article {
+		t.Helper()
+		article := &domain.Article{Title: title, Slug: title, Content: "Content", Author: "jane", Status: domain.ArticlePublished, PublishedAt: &publishedAt}
+		if err := (*repo).CreateArticle(article); err != nil {
+			t.Fatal(err)
+		}
+		return article
+	}
+	create("before", noon.Add(-time.Second))
+	create("noon", noon)
+	create("noon-and-a-half", noon.Add(500*time.Millisecond))
+	create("next-day", noon.Add(12*time.Hour))
+
+	// a draft created by SQLite's clock at noon, and a date written by an
+	// older version with the driver's own format
+	draft := &domain.Article{Title: "draft", Slug: "draft", Content: "Content", Author: "jane", Status: domain.ArticleDraft}
+	if err := (*repo).CreateArticle(draft); err != nil {
+		t.Fatal(err)
+	}
+	legacy := create("legacy", noon)
+	_, err := (*repo).db.Exec(`UPDATE articles SET created_at = '2026-05-01 12:00:00' WHERE id = ?`, draft.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (*repo).db.Exec(`UPDATE articles SET published_at = '2026-05-01 12:00:00.25+00:00' WHERE id = ?`, legacy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// opening the database again migrates the old date
+	repo = newRepository(t, path)
+	var stored string
+	if err := (*repo).db.QueryRow(`SELECT CAST(published_at AS TEXT) FROM articles WHERE id = ?`, legacy.ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != "2026-05-01 12:00:00" {
+		t.Errorf("old published_at migrated to %q, want 2026-05-01 12:00:00", stored)
+	}
+
+	tests := []struct {
+		name  string
+		query domain.ArticleQuery
+		want  string
+	}{
+		{
+			name:  "since is inclusive",
+			query: domain.ArticleQuery{Status: domain.ArticlePublished, Since: noon},
+			want:  "legacy,next-day,noon,noon-and-a-half",
+		},
+		{
+			name:  "until is exclusive",
+			query: domain.ArticleQuery{Status: domain.ArticlePublished, Until: noon},
+			want:  "before",
+		},
+		{
+			name:  "one second",
+			query: domain.ArticleQuery{Status: domain.ArticlePublished, Since: noon, Until: noon.Add(time.Second)},
+			want:  "legacy,noon,noon-and-a-half",
+		},
+		{
+			name:  "other time zone",
+			query: domain.ArticleQuery{Status: domain.ArticlePublished, Since: noon.In(time.FixedZone("UTC+2", 2*60*60)), Until: noon.Add(time.Second)},
+			want:  "legacy,noon,noon-and-a-half",
+		},
+		{
+			name:  "created by SQLite",
+			query: domain.ArticleQuery{Status: domain.ArticleDraft, Sort: domain.SortCreated, Since: noon, Until: noon.Add(time.Second)},
+			want:  "draft",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Sort = cmp.Or(tt.query.Sort, domain.SortPublished)
+			tt.query.Ascending = true
+			page, err := (*repo).ListArticles(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var titles []string
+			for _, article := range page.Articles {
+				titles = append(titles, article.Title)
+			}
+			slices.Sort(titles)
+			if got := strings.Join(titles, ","); got != tt.want || page.Total != len(titles) {
+				t.Errorf("articles %s of %d, want %s", got, page.Total, tt.want)
+			}
+		})
+	}
+}
@@ -1,78 +1,199 @@
 package service
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
+	"blog-system/internal/auth"
 	"blog-system/internal/domain"
 	"blog-system/internal/repository"
 )
 
+var (
+	ErrArticleNotFound      = errors.New("article not found")
+	ErrCommentNotFound      = errors.New("comment not found")
+	ErrForbidden            = errors.New("forbidden")
+	ErrInvalidArticle       = errors.New("invalid article")
+	ErrInvalidComment       = errors.New("invalid comment")
+	ErrInvalidArticleStatus = errors.New("invalid article status")
+	ErrInvalidSchedule      = errors.New("invalid schedule")
+	ErrInvalidSort          = errors.New("invalid sort")
+)
+
+// StatusAll lists articles regardless of their status.
+const StatusAll domain.ArticleStatus = "all"
+
 type BlogService struct {
-	repo repository.BlogRepository
+	repo  repository.BlogRepository
+	audit *AuditLogger
+	now   func() time.Time
 }
 
-func NewBlogService(repo repository.BlogRepository) *BlogService {
-	return &BlogService{repo: repo}
+func NewBlogService(repo repository.BlogRepository, audit *AuditLogger) *BlogService {
+	return &BlogService{
+		repo:  repo,
+		audit: audit,
+		now:   time.Now,
+	}
 }
 
 // -- articles --
-func (s *BlogService) CreateArticle(title, content, author string, tagNames []string) (*domain.Article, error) {
+
+// CreateArticle saves a new draft, or publishes it right away when status is
+// "published".
+func (s *BlogService) CreateArticle(ctx context.Context, title, content, author string, tagNames []string, status domain.ArticleStatus) (*domain.Article, error) {
+	user, ok := auth.GetUserFromContext(ctx)
+	if !ok {
+		return nil, ErrForbidden
+	}
+
 	if strings.TrimSpace(title) == "" {
-		return nil, fmt.Errorf("title field cannot be empty")
+		return nil, fmt.Errorf("%w: title field cannot be empty", ErrInvalidArticle)
 	}
 	if strings.TrimSpace(content) == "" {
-		return nil, fmt.Errorf("content field cannot be empty")
+		return nil, fmt.Errorf("%w: content field cannot be empty", ErrInvalidArticle)
 	}
 	if strings.TrimSpace(author) == "" {
-		return nil, fmt.Errorf("author field cannot be empty")
+		author = user.Username
+	}
+	if status == "" {
+		status = domain.ArticleDraft
+	}
+	if status != domain.ArticleDraft && status != domain.ArticlePublished {
+		return nil, fmt.Errorf("%w: new articles must be draft or published", ErrInvalidArticleStatus)
 	}
 
-	article := &domain.Article{
-		Title:   title,
-		Content: content,
-		Author:  author,
+	tagNames, err := tagList(tagNames)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := (*s).repo.CreateArticle(article); err != nil {
+	article := &domain.Article{
+		Title:    title,
+		Content:  content,
+		Author:   author,
+		AuthorID: user.ID,
+		Status:   status,
+	}
+	if status == domain.ArticlePublished {
+		now := (*s).now().UTC()
+		article.PublishedAt = &now
+	}
+	if err := renderArticle(article); err != nil {
 		return nil, err
 	}
 
-	for _, tagName := range tagNames {
-		tagName = strings.TrimSpace(tagName)
-		if tagName == "" {
-			continue
+	// the article is only saved together with its tags and first revision
+	var created *domain.Article
+	err = (*s).transaction(func(tx *BlogService) error {
+		var err error
+		if article.Slug, err = (*tx).uniqueSlug(title, 0); err != nil {
+			return err
+		}
+		if err := (*tx).repo.CreateArticle(article); err != nil {
+			return err
 		}
+		if err := (*tx).addTags(article.ID, tagNames); err != nil {
+			return err
+		}
+		created, err = (*tx).recordRevision(ctx, article.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		tag := &domain.Tag{Name: tagName}
-		// will fail is exists already, don't return error
-		(*s).repo.CreateTag(tag)
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditArticleCreated,
+		TargetType: "article",
+		TargetID:   auditID(article.ID),
+		After:      map[string]any{"title": article.Title, "status": article.Status},
+	})
 
-		tags, _ := (*s).repo.GetAllTags()
-		for _, t := range tags {
-			if t.Name == tagName {
-				(*s).repo.AddTagToArticle(article.ID, t.ID)
-				break
-			}
+	return created, nil
+}
+
+// GetArticle returns a published article with its comments, drafts and
+// archived articles are only found by users who can edit them.
+func (s *BlogService) GetArticle(ctx context.Context, id int) (*domain.Article, error) {
+	article, err := (*s).repo.GetArticle(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrArticleNotFound
 		}
+		return nil, err
 	}
 
-	return (*s).repo.GetArticle(article.ID)
+	if article.Status != domain.ArticlePublished && !canEditArticle(ctx, article) {
+		return nil, ErrArticleNotFound
+	}
+	return (*s).withComments(article)
 }
 
-func (s *BlogService) GetArticle(id int) (*domain.Article, error) {
-	return (*s).repo.GetArticle(id)
-}
+// GetAllArticles returns a page of articles, continuing from cursor when it
+// is not empty. Without a status only published articles are listed, and
+// StatusAll lists articles of any status. Anyone can list published
+// articles, other statuses need the articles:write permission and only
+// include the user's own articles unless they can edit any article.
+func (s *BlogService) GetAllArticles(ctx context.Context, query domain.ArticleQuery, cursor string) (*ArticleList, error) {
+	if query.Sort == "" {
+		query.Sort = domain.SortPublished
+	}
+	if !query.Sort.Valid() {
+		return nil, ErrInvalidSort
+	}
+	if cursor != "" {
+		if err := applyCursor(&query, cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case query.Status == "":
+		query.Status = domain.ArticlePublished
+	case query.Status == StatusAll:
+		query.Status = ""
+	case !query.Status.Valid():
+		return nil, ErrInvalidArticleStatus
+	}
+
+	if query.Status != domain.ArticlePublished {
+		user, ok := auth.GetUserFromContext(ctx)
+		if !ok || !auth.Can(ctx, auth.PermWriteArticles) {
+			return nil, ErrForbidden
+		}
+		if !auth.Can(ctx, auth.PermEditAnyArticle) {
+			if query.AuthorID != 0 && query.AuthorID != user.ID {
+				return nil, ErrForbidden
+			}
+			query.AuthorID = user.ID
+		}
+	}
 
-func (s *BlogService) GetAllArticles() ([]*domain.Article, error) {
-	return (*s).repo.GetAllArticles()
+	page, err := (*s).repo.ListArticles(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArticleList{
+		Articles:   page.Articles,
+		Total:      page.Total,
+		NextCursor: encodeCursor(query, page.Next, false),
+		PrevCursor: encodeCursor(query, page.Prev, true),
+	}, nil
 }
 
-func (s *BlogService) UpdateArticle(id int, title, content string) (*domain.Article, error) {
-	article, err := (*s).repo.GetArticle(id)
+func (s *BlogService) UpdateArticle(ctx context.Context, id int, title, content string) (*domain.Article, error) {
+	article, err := (*s).getOwnedArticle(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("article not found")
+		return nil, err
 	}
+	before := map[string]any{"title": article.Title, "content_length": len(article.Content)}
 
 	if strings.TrimSpace(title) != "" {
 		article.Title = title
@@ -80,35 +201,172 @@ func (s *BlogService) UpdateArticle(id int, title, content string) (*domain.Arti
 	if strings.TrimSpace(content) != "" {
 		article.Content = content
 	}
+	if err := renderArticle(article); err != nil {
+		return nil, err
+	}
+
+	var updated *domain.Article
+	err = (*s).transaction(func(tx *BlogService) error {
+		if err := (*tx).repo.UpdateArticle(article); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = (*tx).recordRevision(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if err := (*s).repo.UpdateArticle(article); err != nil {
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditArticleUpdated,
+		TargetType: "article",
+		TargetID:   auditID(id),
+		Before:     before,
+		After:      map[string]any{"title": article.Title, "content_length": len(article.Content)},
+	})
+
+	return updated, nil
+}
+
+func (s *BlogService) DeleteArticle(ctx context.Context, id int) error {
+	article, err := (*s).getOwnedArticle(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := (*s).repo.DeleteArticle(id); err != nil {
+		return err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditArticleDeleted,
+		TargetType: "article",
+		TargetID:   auditID(id),
+		Before:     map[string]any{"title": article.Title, "author": article.Author, "author_id": article.AuthorID},
+	})
+	return nil
+}
+
+// PublishArticle makes an article public. published_at is kept when an
+// archived article is published again.
+func (s *BlogService) PublishArticle(ctx context.Context, id int) (*domain.Article, error) {
+	return (*s).setArticleStatus(ctx, id, domain.ArticlePublished, AuditArticlePublished)
+}
+
+// UnpublishArticle turns an article back into a draft and clears published_at.
+func (s *BlogService) UnpublishArticle(ctx context.Context, id int) (*domain.Article, error) {
+	return (*s).setArticleStatus(ctx, id, domain.ArticleDraft, AuditArticleUnpublished)
+}
+
+// ArchiveArticle hides an article from the public while keeping published_at.
+func (s *BlogService) ArchiveArticle(ctx context.Context, id int) (*domain.Article, error) {
+	return (*s).setArticleStatus(ctx, id, domain.ArticleArchived, AuditArticleArchived)
+}
+
+// ScheduleArticle sets when an article is published or unpublished
+// automatically, nil times clear them. Manually changing the status cancels
+// the pending publish, and also the unpublish unless the article is published.
+func (s *BlogService) ScheduleArticle(ctx context.Context, id int, publishAt, unpublishAt *time.Time) (*domain.Article, error) {
+	article, err := (*s).getOwnedArticle(ctx, id)
+	if err != nil {
 		return nil, err
 	}
 
+	now := (*s).now()
+	switch {
+	case publishAt != nil && !publishAt.After(now):
+		return nil, fmt.Errorf("%w: publish_at must be in the future", ErrInvalidSchedule)
+	case unpublishAt != nil && !unpublishAt.After(now):
+		return nil, fmt.Errorf("%w: unpublish_at must be in the future", ErrInvalidSchedule)
+	case publishAt != nil && article.Status == domain.ArticlePublished:
+		return nil, fmt.Errorf("%w: article is already published", ErrInvalidSchedule)
+	case unpublishAt != nil && publishAt == nil && article.Status != domain.ArticlePublished:
+		return nil, fmt.Errorf("%w: unpublish_at needs a published article or a publish_at", ErrInvalidSchedule)
+	case unpublishAt != nil && publishAt != nil && !unpublishAt.After(*publishAt):
+		return nil, fmt.Errorf("%w: unpublish_at must be after publish_at", ErrInvalidSchedule)
+	}
+
+	var scheduledBy int
+	if publishAt != nil || unpublishAt != nil {
+		user, _ := auth.GetUserFromContext(ctx)
+		scheduledBy = user.ID
+	}
+
+	if err := (*s).repo.SetArticleSchedule(id, publishAt, unpublishAt, scheduledBy); err != nil {
+		return nil, err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditArticleScheduled,
+		TargetType: "article",
+		TargetID:   auditID(id),
+		Before:     map[string]any{"publish_at": article.PublishAt, "unpublish_at": article.UnpublishAt},
+		After:      map[string]any{"publish_at": publishAt, "unpublish_at": unpublishAt},
+	})
+
 	return (*s).repo.GetArticle(id)
 }
 
-func (s *BlogService) DeleteArticle(id int) error {
-	_, err := (*s).repo.GetArticle(id)
+// GetUpcomingSchedule lists pending automatic publishes and unpublishes,
+// soonest first. Users who cannot edit any article only see their own.
+func (s *BlogService) GetUpcomingSchedule(ctx context.Context) ([]*domain.ScheduledChange, error) {
+	user, ok := auth.GetUserFromContext(ctx)
+	if !ok || !auth.Can(ctx, auth.PermWriteArticles) {
+		return nil, ErrForbidden
+	}
+
+	var query domain.ArticleQuery
+	if !auth.Can(ctx, auth.PermEditAnyArticle) {
+		query.AuthorID = user.ID
+	}
+
+	articles, err := (*s).repo.GetScheduledArticles(query)
 	if err != nil {
-		return fmt.Errorf("article not found")
+		return nil, err
 	}
 
-	return (*s).repo.DeleteArticle(id)
+	changes := []*domain.ScheduledChange{}
+	for _, article := range articles {
+		if article.PublishAt != nil {
+			changes = append(changes, &domain.ScheduledChange{
+				ArticleID:   article.ID,
+				Title:       article.Title,
+				Action:      "publish",
+				At:          *article.PublishAt,
+				ScheduledBy: article.ScheduledBy,
+			})
+		}
+		if article.UnpublishAt != nil {
+			changes = append(changes, &domain.ScheduledChange{
+				ArticleID:   article.ID,
+				Title:       article.Title,
+				Action:      "unpublish",
+				At:          *article.UnpublishAt,
+				ScheduledBy: article.ScheduledBy,
+			})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].At.Before(changes[j].At)
+	})
+	return changes, nil
 }
 
 // -- comments --
 func (s *BlogService) AddComment(articleID int, author, content string) (*domain.Comment, error) {
 	if strings.TrimSpace(author) == "" {
-		return nil, fmt.Errorf("author field cannot be empty")
+		return nil, fmt.Errorf("%w: author field cannot be empty", ErrInvalidComment)
 	}
 	if strings.TrimSpace(content) == "" {
-		return nil, fmt.Errorf("content field cannot be empty")
+		return nil, fmt.Errorf("%w: content field cannot be empty", ErrInvalidComment)
 	}
 
-	_, err := (*s).repo.GetArticle(articleID)
-	if err != nil {
-		return nil, fmt.Errorf("article not found")
+	article, err := (*s).repo.GetArticle(articleID)
+	if err != nil || article.Status != domain.ArticlePublished {
+		return nil, ErrArticleNotFound
 	}
 
 	comment := &domain.Comment{
@@ -123,3 +381,136 @@ func (s *BlogService) AddComment(articleID int, author, content string) (*domain
 
 	return comment, nil
 }
+
+func (s *BlogService) DeleteComment(ctx context.Context, id int) error {
+	if !auth.Can(ctx, auth.PermModerateComments) {
+		return ErrForbidden
+	}
+
+	comment, err := (*s).repo.GetComment(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCommentNotFound
+		}
+		return err
+	}
+
+	if err := (*s).repo.DeleteComment(id); err != nil {
+		return err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditCommentDeleted,
+		TargetType: "comment",
+		TargetID:   auditID(id),
+		Before:     map[string]any{"article_id": comment.ArticleID, "author": comment.Author, "content_length": len(comment.Content)},
+	})
+	return nil
+}
+
+// -- helpers --
+
+// withComments adds the comments to an article being shown on its own.
+func (s *BlogService) withComments(article *domain.Article) (*domain.Article, error) {
+	comments, err := (*s).repo.GetCommentsByArticleID(article.ID)
+	if err != nil {
+		return nil, err
+	}
+	article.Comments = comments
+	return article, nil
+}
+
+// getOwnedArticle loads an article the current user is allowed to modify.
+func (s *BlogService) getOwnedArticle(ctx context.Context, id int) (*domain.Article, error) {
+	if _, ok := auth.GetUserFromContext(ctx); !ok {
+		return nil, ErrForbidden
+	}
+
+	article, err := (*s).repo.GetArticle(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrArticleNotFound
+		}
+		return nil, err
+	}
+
+	if !canEditArticle(ctx, article) {
+		return nil, ErrForbidden
+	}
+	return article, nil
+}
+
+// transaction runs fn with a copy of the service whose repository changes
+// are kept together, or not at all when fn fails. Audit events are recorded
+// once it returns, the audit log would wait for the transaction to end.
+func (s *BlogService) transaction(fn func(tx *BlogService) error) error {
+	return (*s).repo.Transaction(func(repo repository.BlogRepository) error {
+		tx := *s
+		tx.repo = repo
+		return fn(&tx)
+	})
+}
+
+// addTags adds the named tags to the article, creating missing ones. The
+// names must have been checked with tagList.
+func (s *BlogService) addTags(articleID int, tagNames []string) error {
+	for _, name := range tagNames {
+		tag, err := (*s).repo.UpsertTag(name)
+		if err != nil {
+			return err
+		}
+		if err := (*s).repo.AddTagToArticle(articleID, tag.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canEditArticle reports whether the current user may modify article: their
+// own, or any article if their role can edit everything.
+func canEditArticle(ctx context.Context, article *domain.Article) bool {
+	user, ok := auth.GetUserFromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	if auth.Can(ctx, auth.PermEditAnyArticle) {
+		return true
+	}
+	return auth.Can(ctx, auth.PermWriteArticles) && article.AuthorID == user.ID
+}
+
+func (s *BlogService) setArticleStatus(ctx context.Context, id int, status domain.ArticleStatus, action string) (*domain.Article, error) {
+	article, err := (*s).getOwnedArticle(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if article.Status == status {
+		return article, nil
+	}
+
+	publishedAt := article.PublishedAt
+	switch status {
+	case domain.ArticleDraft:
+		publishedAt = nil
+	case domain.ArticlePublished:
+		if publishedAt == nil {
+			now := (*s).now().UTC()
+			publishedAt = &now
+		}
+	}
+
+	if err := (*s).repo.SetArticleStatus(id, status, publishedAt); err != nil {
+		return nil, err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     action,
+		TargetType: "article",
+		TargetID:   auditID(id),
+		Before:     map[string]any{"status": article.Status},
+		After:      map[string]any{"status": status},
+	})
+
+	return (*s).repo.GetArticle(id)
+}
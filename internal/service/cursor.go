@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"blog-system/internal/domain"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ArticleList is a page of articles. NextCursor and PrevCursor continue the
+// listing and are empty on the last and first page.
+type ArticleList struct {
+	Articles   []*domain.Article
+	Total      int
+	NextCursor string
+	PrevCursor string
+}
+
+// articleCursor is the content of a cursor. The sort and order are kept to
+// reject cursors of a listing sorted another way.
+type articleCursor struct {
+	Sort      domain.ArticleSort `json:"s"`
+	Ascending bool               `json:"a,omitempty"`
+	Before    bool               `json:"b,omitempty"`
+	Key       string             `json:"k"`
+	ID        int                `json:"i"`
+}
+
+// encodeCursor returns an opaque cursor for the page before or after
+// position, or "" when position is nil.
+func encodeCursor(query domain.ArticleQuery, position *domain.ArticleCursor, before bool) string {
+	if position == nil {
+		return ""
+	}
+
+	data, _ := json.Marshal(articleCursor{
+		Sort:      query.Sort,
+		Ascending: query.Ascending,
+		Before:    before,
+		Key:       position.Key,
+		ID:        position.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// applyCursor sets query.After or query.Before from a cursor made by
+// encodeCursor.
+func applyCursor(query *domain.ArticleQuery, cursor string) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c articleCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID < 1 {
+		return ErrInvalidCursor
+	}
+	if c.Sort != query.Sort || c.Ascending != query.Ascending {
+		return fmt.Errorf("%w: the cursor belongs to a listing sorted another way", ErrInvalidCursor)
+	}
+
+	position := &domain.ArticleCursor{Key: c.Key, ID: c.ID}
+	if c.Before {
+		query.Before = position
+	} else {
+		query.After = position
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+	"blog-system/pkg/mailer"
+)
+
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+var magicLink = emailLink{
+	purpose: auth.PurposeMagicLink,
+	ttl:     15 * time.Minute,
+	path:    "/magic-link",
+	subject: "Your login link",
+	intro:   "use the link below to log in.",
+}
+
+type MagicLinkService struct {
+	users repository.UserRepository
+	links *emailLinks
+}
+
+// NewMagicLinkService creates the service, emailed links point to
+// baseURL/magic-link, a page expected to post the token to the API.
+func NewMagicLinkService(users repository.UserRepository, tokens repository.OneTimeTokenRepository, signer OneTimeTokenSigner, mailer mailer.Mailer, baseURL string) *MagicLinkService {
+	return &MagicLinkService{
+		users: users,
+		links: &emailLinks{
+			tokens:  tokens,
+			signer:  signer,
+			mailer:  mailer,
+			baseURL: baseURL,
+			now:     time.Now,
+		},
+	}
+}
+
+// SendLink emails a login link to the user with the address. Unknown and
+// disabled addresses are silently ignored, so the response does not reveal
+// which addresses have accounts.
+func (s *MagicLinkService) SendLink(email string) error {
+	user, err := (*s).users.GetUserByEmail(strings.TrimSpace(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return nil
+	}
+
+	return (*s).links.send(user, magicLink)
+}
+
+// Redeem returns the user the token was issued to and invalidates it.
+func (s *MagicLinkService) Redeem(token string) (*domain.User, error) {
+	userID, ok, err := (*s).links.redeem(auth.PurposeMagicLink, token)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMagicLink
+	}
+
+	user, err := (*s).users.GetUser(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	return user, nil
+}
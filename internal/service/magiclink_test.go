@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"blog-system/internal/domain"
+	"blog-system/pkg/mailer"
+)
+
+func TestMagicLink(t *testing.T) {
+	repo, sessionManager := newTestRepository(t)
+	users := NewUserService(repo, repo, sessionManager, "blog-test")
+	user, err := users.CreateUser("alice", "alice@example.com", "", domain.RoleAuthor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := mailer.NewQuietCaptureMailer()
+	s := NewMagicLinkService(repo, repo, sessionManager, mail, "http://blog.test")
+
+	t.Run("redeemed once", func(t *testing.T) {
+		token := requestMagicLink(t, s, mail, user.Email)
+
+		redeemed, err := s.Redeem(token)
+		if err != nil {
+			t.Fatalf("first redemption: %v", err)
+		}
+		if redeemed.ID != user.ID {
+			t.Errorf("first redemption logged in user %d, want %d", redeemed.ID, user.ID)
+		}
+
+		if _, err := s.Redeem(token); !errors.Is(err, ErrInvalidMagicLink) {
+			t.Errorf("second redemption: error = %v, want %v", err, ErrInvalidMagicLink)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token := requestMagicLink(t, s, mail, user.Email)
+
+		(*s).links.now = func() time.Time { return time.Now().Add(magicLink.ttl + time.Minute) }
+		defer func() { (*s).links.now = time.Now }()
+		if _, err := s.Redeem(token); !errors.Is(err, ErrInvalidMagicLink) {
+			t.Errorf("error = %v, want %v", err, ErrInvalidMagicLink)
+		}
+	})
+}
+
+// requestMagicLink asks for a link to the address and returns the token from
+// the mail sent for it.
+func requestMagicLink(t *testing.T, s *MagicLinkService, mail *mailer.CaptureMailer, email string) string {
+	t.Helper()
+
+	mail.Reset()
+	if err := s.SendLink(email); err != nil {
+		t.Fatal(err)
+	}
+	message, ok := mail.Last(email)
+	if !ok {
+		t.Fatalf("no mail sent to %s", email)
+	}
+
+	for _, field := range strings.Fields(message.Body) {
+		if !strings.HasPrefix(field, "http://blog.test/magic-link?") {
+			continue
+		}
+		link, err := url.Parse(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return link.Query().Get("token")
+	}
+	t.Fatalf("no link in the mail:\n%s", message.Body)
+	return ""
+}
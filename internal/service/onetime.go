@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+	"blog-system/pkg/mailer"
+)
+
+// OneTimeTokenSigner is implemented by auth.SessionManager.
+type OneTimeTokenSigner interface {
+	CreateOneTimeToken(purpose string, userID int, ttl time.Duration) (string, time.Time, error)
+	VerifyOneTimeToken(purpose, token string) (int, bool)
+}
+
+// at most this many links for the same purpose are sent to a user within
+// the link lifetime, so the endpoints cannot be used to flood an inbox
+const emailLinkLimit = 3
+
+// emailLinks sends links carrying signed one-time tokens and redeems them.
+type emailLinks struct {
+	tokens  repository.OneTimeTokenRepository
+	signer  OneTimeTokenSigner
+	mailer  mailer.Mailer
+	baseURL string
+	now     func() time.Time
+}
+
+type emailLink struct {
+	purpose string
+	ttl     time.Duration
+	// path on baseURL the token is appended to
+	path    string
+	subject string
+	// text shown above the link
+	intro string
+}
+
+func (e *emailLinks) send(user *domain.User, link emailLink) error {
+	now := (*e).now()
+	if err := (*e).tokens.DeleteExpiredOneTimeTokens(now); err != nil {
+		return err
+	}
+
+	recent, err := (*e).tokens.CountOneTimeTokensSince(user.ID, link.purpose, now.Add(-link.ttl))
+	if err != nil {
+		return err
+	}
+	if recent >= emailLinkLimit {
+		return nil
+	}
+
+	token, expiresAt, err := (*e).signer.CreateOneTimeToken(link.purpose, user.ID, link.ttl)
+	if err != nil {
+		return err
+	}
+	if err := (*e).tokens.CreateOneTimeToken(auth.HashOneTimeToken(token), user.ID, link.purpose, expiresAt, now); err != nil {
+		return err
+	}
+
+	target := strings.TrimSuffix((*e).baseURL, "/") + link.path + "?token=" + url.QueryEscape(token)
+	return (*e).mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: link.subject,
+		Body: fmt.Sprintf("Hi %s,\n\n%s The link can be used once and expires in %d minutes.\n\n%s\n\nIf you did not ask for it, you can ignore this email.\n",
+			user.Username, link.intro, int(link.ttl.Minutes()), target),
+	})
+}
+
+// redeem returns the user the token was issued to and invalidates it, ok is
+// false for forged, expired and already used tokens.
+func (e *emailLinks) redeem(purpose, token string) (userID int, ok bool, err error) {
+	userID, ok = (*e).signer.VerifyOneTimeToken(purpose, token)
+	if !ok {
+		return 0, false, nil
+	}
+
+	consumed, err := (*e).tokens.ConsumeOneTimeToken(auth.HashOneTimeToken(token), purpose, (*e).now())
+	if err != nil || !consumed {
+		return 0, false, err
+	}
+
+	return userID, true, nil
+}
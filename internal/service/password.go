@@ -0,0 +1,102 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+	"blog-system/pkg/mailer"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset link")
+
+var passwordResetLink = emailLink{
+	purpose: auth.PurposePasswordReset,
+	ttl:     30 * time.Minute,
+	path:    "/reset-password",
+	subject: "Reset your password",
+	intro:   "use the link below to choose a new password.",
+}
+
+// PasswordResetService resets forgotten passwords through emailed links.
+type PasswordResetService struct {
+	users  repository.UserRepository
+	tokens repository.OneTimeTokenRepository
+	links  *emailLinks
+}
+
+// NewPasswordResetService creates the service, emailed links point to
+// baseURL/reset-password, a page expected to post the token and the new
+// password to the API.
+func NewPasswordResetService(users repository.UserRepository, tokens repository.OneTimeTokenRepository, signer OneTimeTokenSigner, mailer mailer.Mailer, baseURL string) *PasswordResetService {
+	return &PasswordResetService{
+		users:  users,
+		tokens: tokens,
+		links: &emailLinks{
+			tokens:  tokens,
+			signer:  signer,
+			mailer:  mailer,
+			baseURL: baseURL,
+			now:     time.Now,
+		},
+	}
+}
+
+// RequestReset emails a reset link to the user with the address. Like
+// MagicLinkService.SendLink it ignores unknown and disabled addresses.
+func (s *PasswordResetService) RequestReset(email string) error {
+	user, err := (*s).users.GetUserByEmail(strings.TrimSpace(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return nil
+	}
+
+	return (*s).links.send(user, passwordResetLink)
+}
+
+// ResetPassword sets the password of the user the token was issued to. Any
+// other reset links sent to the user stop working.
+func (s *PasswordResetService) ResetPassword(token, newPassword string) (*domain.User, error) {
+	// checked first so that a too short password does not use up the token
+	hash, err := hashNewPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, ok, err := (*s).links.redeem(auth.PurposePasswordReset, token)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidResetToken
+	}
+
+	user, err := (*s).users.GetUser(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	if err := (*s).users.SetPasswordHash(userID, hash); err != nil {
+		return nil, err
+	}
+	if err := (*s).tokens.DeleteOneTimeTokens(userID, auth.PurposePasswordReset); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"log"
+
+	"blog-system/internal/domain"
+	"blog-system/pkg/markdown"
+)
+
+// EnsureRendered renders articles whose cached HTML is missing or was made by
+// an older version of the renderer.
+func (s *BlogService) EnsureRendered() error {
+	page, err := (*s).repo.ListArticles(domain.ArticleQuery{})
+	if err != nil {
+		return err
+	}
+
+	rendered := 0
+	for _, article := range page.Articles {
+		if article.RenderVersion == markdown.Version {
+			continue
+		}
+
+		if err := renderArticle(article); err != nil {
+			return err
+		}
+		if err := (*s).repo.SetRenderedContent(article); err != nil {
+			return err
+		}
+		rendered++
+	}
+
+	if rendered > 0 {
+		log.Printf("Rendered %d articles", rendered)
+	}
+	return nil
+}
+
+// -- helpers --
+
+// renderArticle fills in ContentHTML and TOC from Content. It must be called
+// before every save that changes Content.
+func renderArticle(article *domain.Article) error {
+	rendered, err := markdown.Render(article.Content)
+	if err != nil {
+		return err
+	}
+
+	article.ContentHTML = rendered.HTML
+	article.TOC = tocEntries(rendered.TOC)
+	article.RenderVersion = markdown.Version
+	return nil
+}
+
+func tocEntries(headings []*markdown.Heading) []*domain.TOCEntry {
+	entries := make([]*domain.TOCEntry, 0, len(headings))
+	for _, heading := range headings {
+		entry := &domain.TOCEntry{
+			Level:  heading.Level,
+			Text:   heading.Text,
+			Anchor: heading.Anchor,
+		}
+		if len(heading.Children) > 0 {
+			entry.Children = tocEntries(heading.Children)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
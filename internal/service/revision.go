@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/pkg/diff"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrDiffTooLarge     = errors.New("revisions differ too much to compare")
+)
+
+// GetRevisions lists an article's revisions newest first, without their
+// content. Like editing, it is limited to users who can edit the article.
+func (s *BlogService) GetRevisions(ctx context.Context, articleID int) ([]*domain.ArticleRevision, error) {
+	if _, err := (*s).getOwnedArticle(ctx, articleID); err != nil {
+		return nil, err
+	}
+
+	revisions, err := (*s).repo.GetArticleRevisions(articleID)
+	if err != nil {
+		return nil, err
+	}
+	if revisions == nil {
+		revisions = []*domain.ArticleRevision{}
+	}
+	return revisions, nil
+}
+
+func (s *BlogService) GetRevision(ctx context.Context, articleID, revision int) (*domain.ArticleRevision, error) {
+	if _, err := (*s).getOwnedArticle(ctx, articleID); err != nil {
+		return nil, err
+	}
+	return (*s).getRevision(articleID, revision)
+}
+
+// DiffRevisions returns a unified diff from one revision to another, covering
+// the title, the tags and the content. It is empty when nothing changed.
+func (s *BlogService) DiffRevisions(ctx context.Context, articleID, from, to int) (string, error) {
+	if _, err := (*s).getOwnedArticle(ctx, articleID); err != nil {
+		return "", err
+	}
+
+	fromRevision, err := (*s).getRevision(articleID, from)
+	if err != nil {
+		return "", err
+	}
+	toRevision, err := (*s).getRevision(articleID, to)
+	if err != nil {
+		return "", err
+	}
+
+	text, err := diff.Unified(
+		fmt.Sprintf("revision %d", from),
+		fmt.Sprintf("revision %d", to),
+		revisionText(fromRevision),
+		revisionText(toRevision),
+		diff.DefaultContext)
+	if errors.Is(err, diff.ErrTooLarge) {
+		return "", fmt.Errorf("%w: %v", ErrDiffTooLarge, err)
+	}
+	return text, err
+}
+
+// RestoreRevision puts an old revision's title, content and tags back. The
+// result is saved as a new revision, so the restore can be undone as well.
+func (s *BlogService) RestoreRevision(ctx context.Context, articleID, revision int) (*domain.Article, error) {
+	article, err := (*s).getOwnedArticle(ctx, articleID)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := (*s).getRevision(articleID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames, err := tagList(old.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	article.Title = old.Title
+	article.Content = old.Content
+	if err := renderArticle(article); err != nil {
+		return nil, err
+	}
+
+	var restored *domain.Article
+	err = (*s).transaction(func(tx *BlogService) error {
+		if err := (*tx).repo.UpdateArticle(article); err != nil {
+			return err
+		}
+		for _, tag := range article.Tags {
+			if err := (*tx).repo.RemoveTagFromArticle(articleID, tag.ID); err != nil {
+				return err
+			}
+		}
+		if err := (*tx).addTags(articleID, tagNames); err != nil {
+			return err
+		}
+
+		var err error
+		restored, err = (*tx).recordRevision(ctx, articleID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditArticleRestored,
+		TargetType: "article",
+		TargetID:   auditID(articleID),
+		After:      map[string]any{"restored_revision": revision},
+	})
+
+	return restored, nil
+}
+
+// -- helpers --
+
+// recordRevision saves the article's current state as a new revision and
+// returns the article.
+func (s *BlogService) recordRevision(ctx context.Context, articleID int) (*domain.Article, error) {
+	article, err := (*s).repo.GetArticle(articleID)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := &domain.ArticleRevision{
+		ArticleID: articleID,
+		Title:     article.Title,
+		Content:   article.Content,
+		Tags:      []string{},
+		CreatedAt: (*s).now(),
+	}
+	for _, tag := range article.Tags {
+		revision.Tags = append(revision.Tags, tag.Name)
+	}
+	if user, ok := auth.GetUserFromContext(ctx); ok {
+		revision.AuthorID = user.ID
+		revision.AuthorName = user.Username
+	}
+
+	if err := (*s).repo.CreateArticleRevision(revision); err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+func (s *BlogService) getRevision(articleID, revision int) (*domain.ArticleRevision, error) {
+	found, err := (*s).repo.GetArticleRevision(articleID, revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return found, nil
+}
+
+// revisionText is what DiffRevisions compares.
+func revisionText(revision *domain.ArticleRevision) string {
+	return fmt.Sprintf("Title: %s\nTags: %s\n\n%s\n",
+		revision.Title,
+		strings.Join(revision.Tags, ", "),
+		revision.Content)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+)
+
+// Scheduler publishes and unpublishes articles once their publish_at or
+// unpublish_at has passed. Several servers can run one against the same
+// database, every change is made and audited by exactly one of them.
+type Scheduler struct {
+	repo     repository.BlogRepository
+	audit    *AuditLogger
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewScheduler(repo repository.BlogRepository, audit *AuditLogger, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		repo:     repo,
+		audit:    audit,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run checks for due articles right away and then every interval, until ctx
+// is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker((*s).interval)
+	defer ticker.Stop()
+
+	for {
+		// errors are usually a busy database, the next tick retries
+		if err := (*s).RunOnce(ctx); err != nil {
+			log.Println("Scheduler:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce makes every change that is due now.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	now := (*s).now()
+
+	published, err := (*s).repo.PublishDueArticles(now)
+	(*s).record(ctx, published, AuditArticlePublished, domain.ArticlePublished)
+	if err != nil {
+		return err
+	}
+
+	unpublished, err := (*s).repo.UnpublishDueArticles(now)
+	(*s).record(ctx, unpublished, AuditArticleUnpublished, domain.ArticleDraft)
+	return err
+}
+
+// -- helpers --
+func (s *Scheduler) record(ctx context.Context, articles []*domain.Article, action string, status domain.ArticleStatus) {
+	for _, article := range articles {
+		log.Printf("Scheduler: article %d is now %s", article.ID, status)
+		(*s).audit.Record(ctx, AuditEntry{
+			Action:     action,
+			ActorName:  SchedulerActor,
+			TargetType: "article",
+			TargetID:   auditID(article.ID),
+			After:      map[string]any{"status": status, "scheduled_by": article.ScheduledBy},
+		})
+	}
+}
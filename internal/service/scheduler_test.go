@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+	"blog-system/pkg/database"
+)
+
+func TestSchedulerSharedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blog.db")
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// every server has its own connections to the database
+	var repos []*repository.SQLiteRepository
+	for range 3 {
+		db, err := database.NewSQLiteDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		repos = append(repos, repository.NewSQLiteRepository(db))
+	}
+	repo := repos[0]
+
+	userService := NewUserService(repo, repo, nil, "blog-test")
+	scheduler, err := userService.CreateUser("scheduler", "", "correct horse battery", domain.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule := func(title string, status domain.ArticleStatus, publishAt, unpublishAt *time.Time) *domain.Article {
+		t.Helper()
+		article := &domain.Article{Title: title, Slug: strings.ToLower(title), Content: "Content", Author: "jane", Status: status}
+		if status == domain.ArticlePublished {
+			article.PublishedAt = &now
+		}
+		if err := (*repo).CreateArticle(article); err != nil {
+			t.Fatal(err)
+		}
+		if err := (*repo).SetArticleSchedule(article.ID, publishAt, unpublishAt, (*scheduler).ID); err != nil {
+			t.Fatal(err)
+		}
+		return article
+	}
+	at := func(d time.Duration) *time.Time {
+		when := now.Add(d)
+		return &when
+	}
+
+	var due []*domain.Article
+	for i := range 20 {
+		due = append(due, schedule(fmt.Sprintf("Publish-%d", i), domain.ArticleDraft, at(-time.Duration(i)*time.Minute), nil))
+		due = append(due, schedule(fmt.Sprintf("Unpublish-%d", i), domain.ArticlePublished, nil, at(-time.Duration(i)*time.Minute)))
+	}
+	later := schedule("Later", domain.ArticleDraft, at(time.Minute), at(time.Hour))
+	exact := schedule("Exact", domain.ArticleDraft, at(0), nil)
+	due = append(due, exact)
+
+	// the servers' schedulers all wake up at once
+	var wg sync.WaitGroup
+	for _, repo := range repos {
+		scheduler := NewScheduler(repo, NewAuditLogger(repo), time.Minute)
+		(*scheduler).now = func() time.Time { return now }
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := scheduler.RunOnce(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	events, err := (*repo).GetAuditEvents(domain.AuditFilter{Action: "article.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	audited := map[string]int{}
+	for _, event := range events {
+		if event.ActorName != SchedulerActor || !strings.Contains(event.After, fmt.Sprintf(`"scheduled_by":%d`, (*scheduler).ID)) {
+			t.Errorf("event %s by %q after %s, want the scheduler and who scheduled it", event.Action, event.ActorName, event.After)
+		}
+		audited[event.TargetID]++
+	}
+
+	for _, article := range due {
+		if count := audited[auditID(article.ID)]; count != 1 {
+			t.Errorf("%s: audited %d times, want once", article.Title, count)
+		}
+
+		changed, err := (*repo).GetArticle(article.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := domain.ArticlePublished
+		if article.Status == domain.ArticlePublished {
+			want = domain.ArticleDraft
+		}
+		if changed.Status != want || changed.PublishAt != nil || changed.UnpublishAt != nil {
+			t.Errorf("%s: %s scheduled at %v and %v, want %s and nothing scheduled", article.Title, changed.Status, changed.PublishAt, changed.UnpublishAt, want)
+		}
+	}
+
+	unchanged, err := (*repo).GetArticle(later.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.Status != domain.ArticleDraft || unchanged.PublishAt == nil || unchanged.UnpublishAt == nil {
+		t.Errorf("article scheduled later is %s scheduled at %v and %v", unchanged.Status, unchanged.PublishAt, unchanged.UnpublishAt)
+	}
+	if len(events) != len(due) {
+		t.Errorf("%d audit events, want %d", len(events), len(due))
+	}
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"blog-system/internal/domain"
+)
+
+var (
+	ErrSearchUnavailable = errors.New("search is not available")
+	ErrInvalidSearch     = errors.New("invalid search")
+)
+
+// Search finds published articles, best matches first, and counts all
+// matches.
+func (s *BlogService) Search(query domain.SearchQuery) ([]*domain.SearchResult, int, error) {
+	if strings.TrimSpace(query.Text) == "" {
+		return nil, 0, fmt.Errorf("%w: search text cannot be empty", ErrInvalidSearch)
+	}
+
+	available, err := (*s).repo.SearchAvailable()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !available {
+		return nil, 0, ErrSearchUnavailable
+	}
+
+	query.Status = domain.ArticlePublished
+	return (*s).repo.SearchArticles(query)
+}
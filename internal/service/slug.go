@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"blog-system/internal/domain"
+	"blog-system/pkg/slug"
+)
+
+var (
+	ErrInvalidSlug = errors.New("slug must contain letters or digits")
+	ErrSlugTaken   = errors.New("slug is already used by another article")
+)
+
+// GetArticleBySlug finds an article by its current or a former slug, with the
+// same visibility as GetArticle. For former slugs it also returns the current
+// one, which the article should be redirected to.
+func (s *BlogService) GetArticleBySlug(ctx context.Context, articleSlug string) (*domain.Article, string, error) {
+	article, err := (*s).repo.GetArticleBySlug(articleSlug)
+	if err == nil {
+		if article.Status != domain.ArticlePublished && !canEditArticle(ctx, article) {
+			return nil, "", ErrArticleNotFound
+		}
+		article, err = (*s).withComments(article)
+		return article, "", err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, "", err
+	}
+
+	id, err := (*s).repo.GetArticleIDByOldSlug(articleSlug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrArticleNotFound
+		}
+		return nil, "", err
+	}
+
+	article, err = (*s).GetArticle(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	return article, article.Slug, nil
+}
+
+// SetSlug changes an article's slug, an empty one is generated from the title
+// again. The old slug keeps redirecting to the article.
+func (s *BlogService) SetSlug(ctx context.Context, id int, requested string) (*domain.Article, error) {
+	article, err := (*s).getOwnedArticle(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var newSlug string
+	if strings.TrimSpace(requested) == "" {
+		newSlug, err = (*s).uniqueSlug(article.Title, id)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		newSlug = slug.Make(requested)
+		if newSlug == "" {
+			return nil, ErrInvalidSlug
+		}
+
+		taken, err := (*s).repo.IsSlugTaken(newSlug, id)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, ErrSlugTaken
+		}
+	}
+
+	if newSlug == article.Slug {
+		return article, nil
+	}
+	if err := (*s).repo.SetArticleSlug(id, newSlug); err != nil {
+		return nil, err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditArticleSlugChanged,
+		TargetType: "article",
+		TargetID:   auditID(id),
+		Before:     map[string]any{"slug": article.Slug},
+		After:      map[string]any{"slug": newSlug},
+	})
+
+	return (*s).repo.GetArticle(id)
+}
+
+// EnsureSlugs gives articles created before slugs existed one.
+func (s *BlogService) EnsureSlugs() error {
+	page, err := (*s).repo.ListArticles(domain.ArticleQuery{})
+	if err != nil {
+		return err
+	}
+
+	for _, article := range page.Articles {
+		if article.Slug != "" {
+			continue
+		}
+
+		newSlug, err := (*s).uniqueSlug(article.Title, article.ID)
+		if err != nil {
+			return err
+		}
+		if err := (*s).repo.SetArticleSlug(article.ID, newSlug); err != nil {
+			return err
+		}
+		log.Printf("Article %d got the slug %q", article.ID, newSlug)
+	}
+	return nil
+}
+
+// -- helpers --
+
+// uniqueSlug makes a slug from text that no article other than articleID
+// uses or used, adding "-2", "-3"... when needed.
+func (s *BlogService) uniqueSlug(text string, articleID int) (string, error) {
+	base := slug.Make(text)
+	if base == "" {
+		base = "article"
+	}
+
+	for n := 1; ; n++ {
+		candidate := slug.WithSuffix(base, n)
+		taken, err := (*s).repo.IsSlugTaken(candidate, articleID)
+		if err != nil {
+			return "", fmt.Errorf("checking slug %q: %w", candidate, err)
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
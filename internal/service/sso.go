@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+)
+
+var ErrSSONotAllowed = errors.New("account is not allowed to log in with single sign-on")
+
+// SSOActor is the actor of role changes made by the group mapping.
+const SSOActor = "oidc"
+
+// when a user's groups map to several roles the first one in this list wins
+var ssoRolePrecedence = []domain.Role{domain.RoleAdmin, domain.RoleEditor, domain.RoleAuthor, domain.RoleModerator}
+
+var invalidUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// SSORoleMapping decides the role of users logging in through the identity
+// provider. Users in none of GroupRoles' groups get DefaultRole, or are
+// turned away when it is empty.
+type SSORoleMapping struct {
+	GroupRoles  map[string]domain.Role
+	DefaultRole domain.Role
+}
+
+type SSOService struct {
+	repo    repository.UserRepository
+	mapping SSORoleMapping
+	audit   *AuditLogger
+}
+
+func NewSSOService(repo repository.UserRepository, mapping SSORoleMapping, audit *AuditLogger) *SSOService {
+	return &SSOService{
+		repo:    repo,
+		mapping: mapping,
+		audit:   audit,
+	}
+}
+
+// LoginWithOIDC returns the local user for a verified identity. Users are
+// found by their provider subject, then by verified email for accounts that
+// were created locally, and are created otherwise. The role of accounts
+// created through single sign-on follows the user's groups on every login,
+// linked local accounts keep the role an admin gave them.
+func (s *SSOService) LoginWithOIDC(ctx context.Context, claims *auth.OIDCClaims) (*domain.User, error) {
+	role := (*s).roleFor(claims.Groups)
+	if role == "" {
+		return nil, ErrSSONotAllowed
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email = strings.TrimSpace(claims.Email)
+	}
+
+	user, err := (*s).repo.GetUserByOIDCSubject(claims.Subject)
+	if errors.Is(err, sql.ErrNoRows) && email != "" {
+		user, err = (*s).linkByEmail(claims.Subject, email)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return (*s).createUser(claims, email, role)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if user.SSOManaged && user.Role != role {
+		if err := (*s).repo.SetUserRole(user.ID, role); err != nil {
+			return nil, err
+		}
+
+		(*s).audit.Record(ctx, AuditEntry{
+			Action:     AuditUserRoleChanged,
+			ActorName:  SSOActor,
+			TargetType: "user",
+			TargetID:   auditID(user.ID),
+			Before:     map[string]any{"role": user.Role},
+			After:      map[string]any{"role": role, "groups": claims.Groups},
+		})
+		user.Role = role
+	}
+
+	return user, nil
+}
+
+// -- helpers --
+func (s *SSOService) roleFor(groups []string) domain.Role {
+	matched := make(map[domain.Role]bool)
+	for _, group := range groups {
+		if role, exists := (*s).mapping.GroupRoles[group]; exists {
+			matched[role] = true
+		}
+	}
+
+	for _, role := range ssoRolePrecedence {
+		if matched[role] {
+			return role
+		}
+	}
+	return (*s).mapping.DefaultRole
+}
+
+func (s *SSOService) linkByEmail(subject, email string) (*domain.User, error) {
+	user, err := (*s).repo.GetUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	// already tied to a different identity, someone reusing the address
+	// must not take the account over
+	if user.OIDCSubject != "" {
+		return nil, ErrSSONotAllowed
+	}
+
+	if err := (*s).repo.LinkOIDCSubject(user.ID, subject, email); err != nil {
+		return nil, err
+	}
+	user.OIDCSubject = subject
+	return user, nil
+}
+
+func (s *SSOService) createUser(claims *auth.OIDCClaims, email string, role domain.Role) (*domain.User, error) {
+	username, err := (*s).availableUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty password hash never matches, SSO users cannot log in with a
+	// password
+	user := &domain.User{
+		Username:    username,
+		Email:       email,
+		OIDCSubject: claims.Subject,
+		SSOManaged:  true,
+		Role:        role,
+	}
+	if err := (*s).repo.CreateUser(user); err != nil {
+		return nil, err
+	}
+
+	return (*s).repo.GetUser(user.ID)
+}
+
+// availableUsername derives a username from the identity's claims, adding a
+// number when it is already taken.
+func (s *SSOService) availableUsername(claims *auth.OIDCClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Trim(invalidUsernameChars.ReplaceAllString(base, ""), ".-")
+	if len(base) > 28 {
+		base = base[:28]
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	for i := 1; i < 100; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s%d", base, i)
+		}
+
+		_, err := (*s).repo.GetUserByUsername(username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return username, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("no free username for %q", base)
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+)
+
+// MaxTagLength is the longest tag name, in characters.
+const MaxTagLength = 50
+
+var (
+	ErrTagNotFound   = errors.New("tag not found")
+	ErrTagExists     = errors.New("tag already exists")
+	ErrInvalidTag    = errors.New("invalid tag name")
+	ErrMergeSameTags = errors.New("cannot merge a tag into itself")
+)
+
+// GetTags lists every tag by name, with the number of published articles
+// that have it.
+func (s *BlogService) GetTags() ([]*domain.TagUsage, error) {
+	return (*s).repo.GetTagUsage()
+}
+
+func (s *BlogService) CreateTag(ctx context.Context, name string) (*domain.Tag, error) {
+	if !auth.Can(ctx, auth.PermWriteArticles) {
+		return nil, ErrForbidden
+	}
+
+	name, err := tagName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := (*s).checkTagNameFree(name, 0); err != nil {
+		return nil, err
+	}
+
+	tag := &domain.Tag{Name: name}
+	if err := (*s).repo.CreateTag(tag); err != nil {
+		return nil, err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditTagCreated,
+		TargetType: "tag",
+		TargetID:   auditID(tag.ID),
+		After:      map[string]any{"name": tag.Name},
+	})
+	return tag, nil
+}
+
+// RenameTag changes the name of a tag on all its articles. Renaming to the
+// name of another tag fails, MergeTags combines them instead.
+func (s *BlogService) RenameTag(ctx context.Context, id int, name string) (*domain.Tag, error) {
+	if !auth.Can(ctx, auth.PermEditAnyArticle) {
+		return nil, ErrForbidden
+	}
+
+	tag, err := (*s).getTag(id)
+	if err != nil {
+		return nil, err
+	}
+	name, err = tagName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := (*s).checkTagNameFree(name, id); err != nil {
+		return nil, err
+	}
+
+	if err := (*s).repo.RenameTag(id, name); err != nil {
+		return nil, err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditTagRenamed,
+		TargetType: "tag",
+		TargetID:   auditID(id),
+		Before:     map[string]any{"name": tag.Name},
+		After:      map[string]any{"name": name},
+	})
+
+	tag.Name = name
+	return tag, nil
+}
+
+// MergeTags gives the articles of the source tag the target tag instead, and
+// deletes the source tag.
+func (s *BlogService) MergeTags(ctx context.Context, sourceID, targetID int) (*domain.Tag, error) {
+	if !auth.Can(ctx, auth.PermEditAnyArticle) {
+		return nil, ErrForbidden
+	}
+	if sourceID == targetID {
+		return nil, ErrMergeSameTags
+	}
+
+	source, err := (*s).getTag(sourceID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := (*s).getTag(targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := (*s).repo.MergeTags(sourceID, targetID); err != nil {
+		return nil, err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditTagMerged,
+		TargetType: "tag",
+		TargetID:   auditID(sourceID),
+		Before:     map[string]any{"name": source.Name},
+		After:      map[string]any{"merged_into": target.ID, "name": target.Name},
+	})
+	return target, nil
+}
+
+// DeleteTag deletes a tag and removes it from its articles.
+func (s *BlogService) DeleteTag(ctx context.Context, id int) error {
+	if !auth.Can(ctx, auth.PermEditAnyArticle) {
+		return ErrForbidden
+	}
+
+	tag, err := (*s).getTag(id)
+	if err != nil {
+		return err
+	}
+
+	if err := (*s).repo.DeleteTag(id); err != nil {
+		return err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditTagDeleted,
+		TargetType: "tag",
+		TargetID:   auditID(id),
+		Before:     map[string]any{"name": tag.Name},
+	})
+	return nil
+}
+
+// AddArticleTags adds the named tags to an article, creating missing ones.
+func (s *BlogService) AddArticleTags(ctx context.Context, articleID int, names []string) (*domain.Article, error) {
+	article, err := (*s).getOwnedArticle(ctx, articleID)
+	if err != nil {
+		return nil, err
+	}
+	return (*s).replaceArticleTags(ctx, article, append(articleTagNames(article), names...))
+}
+
+func (s *BlogService) RemoveArticleTag(ctx context.Context, articleID, tagID int) (*domain.Article, error) {
+	article, err := (*s).getOwnedArticle(ctx, articleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	found := false
+	for _, tag := range article.Tags {
+		if tag.ID == tagID {
+			found = true
+			continue
+		}
+		names = append(names, tag.Name)
+	}
+	if !found {
+		return nil, ErrTagNotFound
+	}
+
+	return (*s).replaceArticleTags(ctx, article, names)
+}
+
+// SetArticleTags gives an article exactly the named tags.
+func (s *BlogService) SetArticleTags(ctx context.Context, articleID int, names []string) (*domain.Article, error) {
+	article, err := (*s).getOwnedArticle(ctx, articleID)
+	if err != nil {
+		return nil, err
+	}
+	return (*s).replaceArticleTags(ctx, article, names)
+}
+
+// -- helpers --
+
+// replaceArticleTags gives article exactly the named tags, creating missing
+// ones. A change is saved as a revision.
+func (s *BlogService) replaceArticleTags(ctx context.Context, article *domain.Article, names []string) (*domain.Article, error) {
+	wanted, err := tagList(names)
+	if err != nil {
+		return nil, err
+	}
+
+	before := articleTagNames(article)
+	var removed, added []string
+	for _, tag := range article.Tags {
+		if !slices.Contains(wanted, tag.Name) {
+			removed = append(removed, tag.Name)
+		}
+	}
+	for _, name := range wanted {
+		if !slices.Contains(before, name) {
+			added = append(added, name)
+		}
+	}
+	if len(removed) == 0 && len(added) == 0 {
+		return article, nil
+	}
+
+	var updated *domain.Article
+	err = (*s).transaction(func(tx *BlogService) error {
+		for _, tag := range article.Tags {
+			if !slices.Contains(removed, tag.Name) {
+				continue
+			}
+			if err := (*tx).repo.RemoveTagFromArticle(article.ID, tag.ID); err != nil {
+				return err
+			}
+		}
+		if err := (*tx).addTags(article.ID, added); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = (*tx).recordRevision(ctx, article.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	(*s).audit.Record(ctx, AuditEntry{
+		Action:     AuditArticleTagsChanged,
+		TargetType: "article",
+		TargetID:   auditID(article.ID),
+		Before:     map[string]any{"tags": before},
+		After:      map[string]any{"tags": articleTagNames(updated)},
+	})
+	return updated, nil
+}
+
+func (s *BlogService) getTag(id int) (*domain.Tag, error) {
+	tag, err := (*s).repo.GetTag(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	return tag, nil
+}
+
+// checkTagNameFree fails with ErrTagExists when a tag other than id is
+// called name.
+func (s *BlogService) checkTagNameFree(name string, id int) error {
+	existing, err := (*s).repo.GetTagByName(name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return err
+	case existing.ID != id:
+		return fmt.Errorf("%w: %q", ErrTagExists, name)
+	}
+	return nil
+}
+
+// tagName trims name and checks that it is usable.
+func tagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%w: tag names cannot be empty", ErrInvalidTag)
+	}
+	if utf8.RuneCountInString(name) > MaxTagLength {
+		return "", fmt.Errorf("%w: tag names are at most %d characters", ErrInvalidTag, MaxTagLength)
+	}
+	return name, nil
+}
+
+// tagList checks and trims names, dropping blank and repeated ones.
+func tagList(names []string) ([]string, error) {
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		name, err := tagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(list, name) {
+			list = append(list, name)
+		}
+	}
+	return list, nil
+}
+
+func articleTagNames(article *domain.Article) []string {
+	names := []string{}
+	for _, tag := range article.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
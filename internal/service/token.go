@@ -0,0 +1,134 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+)
+
+var (
+	ErrInvalidAPIToken  = errors.New("invalid or expired API token")
+	ErrAPITokenNotFound = errors.New("API token not found")
+)
+
+const (
+	defaultAPITokenLifetime = 90 * 24 * time.Hour
+	maxAPITokenLifetime     = 365 * 24 * time.Hour
+)
+
+type TokenService struct {
+	repo  repository.APITokenRepository
+	users repository.UserRepository
+	now   func() time.Time
+}
+
+func NewTokenService(repo repository.APITokenRepository, users repository.UserRepository) *TokenService {
+	return &TokenService{
+		repo:  repo,
+		users: users,
+		now:   time.Now,
+	}
+}
+
+// CreateToken mints a token for the user. Scopes are limited to permissions
+// the user's role has, a zero lifetime means the default of 90 days. The
+// returned plaintext token cannot be retrieved again.
+func (s *TokenService) CreateToken(user *domain.User, name string, scopes []string, lifetime time.Duration) (string, *domain.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("name field cannot be empty")
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		perm := auth.Permission(scope)
+		if !auth.ValidPermission(perm) {
+			return "", nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !auth.HasPermission(user, perm) {
+			return "", nil, fmt.Errorf("your role does not allow the %q scope", scope)
+		}
+	}
+
+	if lifetime == 0 {
+		lifetime = defaultAPITokenLifetime
+	}
+	if lifetime < 0 || lifetime > maxAPITokenLifetime {
+		return "", nil, fmt.Errorf("token lifetime must be between 1 and 365 days")
+	}
+
+	plaintext, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := (*s).now()
+	token := &domain.APIToken{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hash,
+		Scopes:    scopes,
+		ExpiresAt: now.Add(lifetime),
+		CreatedAt: now,
+	}
+
+	if err := (*s).repo.CreateAPIToken(token); err != nil {
+		return "", nil, err
+	}
+
+	return plaintext, token, nil
+}
+
+func (s *TokenService) GetTokens(userID int) ([]*domain.APIToken, error) {
+	return (*s).repo.GetAPITokensByUserID(userID)
+}
+
+func (s *TokenService) RevokeToken(userID int, id int) error {
+	deleted, err := (*s).repo.DeleteAPIToken(userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// AuthenticateToken implements auth.TokenAuthenticator.
+func (s *TokenService) AuthenticateToken(plaintext string) (*domain.User, *domain.APIToken, error) {
+	if !auth.IsAPIToken(plaintext) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	token, err := (*s).repo.GetAPITokenByHash(auth.HashAPIToken(plaintext))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := (*s).now()
+	if !token.ExpiresAt.After(now) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	user, err := (*s).users.GetUser(token.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	if err := (*s).repo.TouchAPIToken(token.ID, now); err != nil {
+		return nil, nil, err
+	}
+	token.LastUsedAt = &now
+
+	return user, token, nil
+}
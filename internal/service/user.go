@@ -0,0 +1,484 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserDisabled       = errors.New("account is disabled")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidTOTPCode    = errors.New("invalid two-factor code")
+	ErrInvalidPreAuth     = errors.New("invalid or expired pre-auth token")
+)
+
+const (
+	minPasswordLength = 8
+	recoveryCodeCount = 10
+	// codes that can be tried with one pre-auth token, on top of the login
+	// limiter, before the password has to be entered again
+	maxPreAuthAttempts = 5
+)
+
+// PreAuthTokenSigner is implemented by auth.SessionManager.
+type PreAuthTokenSigner interface {
+	CreatePreAuthToken(userID int, remember bool) (string, time.Time, error)
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+// compared against when the username does not exist, so that failed lookups
+// take as long as failed password checks
+var dummyPasswordHash, _ = auth.HashPassword("dummy-password")
+
+type UserService struct {
+	repo       repository.UserRepository
+	tokens     repository.OneTimeTokenRepository
+	preAuth    PreAuthTokenSigner
+	totpIssuer string
+	now        func() time.Time
+}
+
+// NewUserService creates the service, totpIssuer is the name authenticator
+// apps show next to the account.
+func NewUserService(repo repository.UserRepository, tokens repository.OneTimeTokenRepository, preAuth PreAuthTokenSigner, totpIssuer string) *UserService {
+	return &UserService{
+		repo:       repo,
+		tokens:     tokens,
+		preAuth:    preAuth,
+		totpIssuer: totpIssuer,
+		now:        time.Now,
+	}
+}
+
+// EnsureAdmin creates the initial admin account when the users table is empty.
+func (s *UserService) EnsureAdmin(username, password string) error {
+	count, err := (*s).repo.CountUsers()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if password == "" {
+		return fmt.Errorf("no users exist, ADMIN_PASSWORD is required to create the initial admin account")
+	}
+
+	_, err = (*s).CreateUser(username, "", password, domain.RoleAdmin)
+	return err
+}
+
+// CreateUser adds a local account. The password may be left empty for users
+// with an email address, who then log in through emailed links only.
+func (s *UserService) CreateUser(username, email, password string, role domain.Role) (*domain.User, error) {
+	if role == "" {
+		role = domain.RoleAuthor
+	}
+	if !role.Valid() {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+
+	username = strings.TrimSpace(username)
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("username must be 3-32 characters of letters, digits, '_', '.' or '-'")
+	}
+	email, err := (*s).checkEmail(0, email)
+	if err != nil {
+		return nil, err
+	}
+	if password == "" && email == "" {
+		return nil, fmt.Errorf("a password is required for users without an email address")
+	}
+
+	if _, err := (*s).repo.GetUserByUsername(username); err == nil {
+		return nil, fmt.Errorf("username already taken")
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// an empty hash never matches, passwordless users cannot log in with one
+	hash := ""
+	if password != "" {
+		if hash, err = hashNewPassword(password); err != nil {
+			return nil, err
+		}
+	}
+
+	user := &domain.User{
+		Username:     username,
+		Email:        email,
+		PasswordHash: hash,
+		Role:         role,
+	}
+
+	if err := (*s).repo.CreateUser(user); err != nil {
+		return nil, err
+	}
+
+	return (*s).repo.GetUser(user.ID)
+}
+
+func (s *UserService) Authenticate(username, password string) (*domain.User, error) {
+	user, err := (*s).repo.GetUserByUsername(strings.TrimSpace(username))
+	if err != nil {
+		auth.CheckPassword(dummyPasswordHash, password)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if !auth.CheckPassword(user.PasswordHash, password) {
+		return nil, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	return user, nil
+}
+
+func (s *UserService) GetUser(id int) (*domain.User, error) {
+	user, err := (*s).repo.GetUser(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *UserService) GetAllUsers() ([]*domain.User, error) {
+	return (*s).repo.GetAllUsers()
+}
+
+func (s *UserService) SetUserDisabled(id int, disabled bool) (*domain.User, error) {
+	if _, err := (*s).GetUser(id); err != nil {
+		return nil, err
+	}
+
+	if err := (*s).repo.SetUserDisabled(id, disabled); err != nil {
+		return nil, err
+	}
+
+	return (*s).repo.GetUser(id)
+}
+
+func (s *UserService) SetUserRole(id int, role domain.Role) (*domain.User, error) {
+	if !role.Valid() {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+
+	if _, err := (*s).GetUser(id); err != nil {
+		return nil, err
+	}
+
+	if err := (*s).repo.SetUserRole(id, role); err != nil {
+		return nil, err
+	}
+
+	return (*s).repo.GetUser(id)
+}
+
+// ChangePassword sets a new password after checking the current one.
+// Passwordless users have to use the password reset instead.
+func (s *UserService) ChangePassword(userID int, currentPassword, newPassword string) error {
+	user, err := (*s).GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if !auth.CheckPassword(user.PasswordHash, currentPassword) {
+		return ErrInvalidCredentials
+	}
+
+	hash, err := hashNewPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return (*s).repo.SetPasswordHash(userID, hash)
+}
+
+// SetUserEmail changes the address, an empty one removes it.
+func (s *UserService) SetUserEmail(id int, email string) (*domain.User, error) {
+	if _, err := (*s).GetUser(id); err != nil {
+		return nil, err
+	}
+
+	email, err := (*s).checkEmail(id, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := (*s).repo.SetUserEmail(id, email); err != nil {
+		return nil, err
+	}
+
+	return (*s).repo.GetUser(id)
+}
+
+func (s *UserService) DeleteUser(id int) error {
+	if _, err := (*s).GetUser(id); err != nil {
+		return err
+	}
+
+	return (*s).repo.DeleteUser(id)
+}
+
+// -- two-factor authentication --
+
+// BeginTOTPEnrollment generates a new secret for the user. Two-factor stays
+// disabled until ConfirmTOTPEnrollment is called with a code generated from it.
+func (s *UserService) BeginTOTPEnrollment(userID int) (secret string, provisioningURI string, err error) {
+	user, err := (*s).GetUser(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled {
+		return "", "", fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	secret, err = auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := (*s).repo.SetTOTPSecret(userID, secret); err != nil {
+		return "", "", err
+	}
+
+	return secret, auth.TOTPProvisioningURI((*s).totpIssuer, user.Username, secret), nil
+}
+
+// ConfirmTOTPEnrollment enables two-factor and returns a fresh set of
+// recovery codes, which are only ever shown here.
+func (s *UserService) ConfirmTOTPEnrollment(userID int, code string) ([]string, error) {
+	user, err := (*s).GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("two-factor enrollment has not been started")
+	}
+
+	if err := (*s).verifyTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	if err := (*s).repo.EnableTOTP(userID); err != nil {
+		return nil, err
+	}
+
+	return (*s).regenerateRecoveryCodes(userID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, it requires a
+// current TOTP code.
+func (s *UserService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	user, err := (*s).GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is not enabled")
+	}
+
+	if err := (*s).verifyTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	return (*s).regenerateRecoveryCodes(userID)
+}
+
+// DisableTOTP turns two-factor off for the user, it requires their password.
+func (s *UserService) DisableTOTP(userID int, password string) error {
+	user, err := (*s).GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if !auth.CheckPassword(user.PasswordHash, password) {
+		return ErrInvalidCredentials
+	}
+
+	return (*s).repo.DisableTOTP(userID)
+}
+
+// ResetTOTP turns two-factor off without any checks, for admins helping
+// users who lost both their device and recovery codes.
+func (s *UserService) ResetTOTP(userID int) error {
+	if _, err := (*s).GetUser(userID); err != nil {
+		return err
+	}
+
+	return (*s).repo.DisableTOTP(userID)
+}
+
+// StartSecondFactor issues the pre-auth token a user who passed the first
+// login step exchanges for a session with VerifySecondFactor.
+func (s *UserService) StartSecondFactor(userID int, remember bool) (string, time.Time, error) {
+	now := (*s).now()
+	if err := (*s).tokens.DeleteExpiredOneTimeTokens(now); err != nil {
+		return "", time.Time{}, err
+	}
+
+	token, expiresAt, err := (*s).preAuth.CreatePreAuthToken(userID, remember)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := (*s).tokens.CreateOneTimeToken(auth.HashOneTimeToken(token), userID, auth.PurposePreAuth, expiresAt, now); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// VerifySecondFactor completes a login for a user with two-factor enabled,
+// using either a TOTP code or one of the recovery codes. The pre-auth token,
+// already checked to be signed for userID, allows a few wrong TOTP codes. It
+// is used up before anything else is, so a recovery code is only spent on a
+// token that was still valid, and a wrong one needs a new login.
+func (s *UserService) VerifySecondFactor(userID int, preAuthToken, code, recoveryCode string) (*domain.User, error) {
+	user, err := (*s).GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if !user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is not enabled")
+	}
+
+	tokenHash := auth.HashOneTimeToken(preAuthToken)
+	allowed, err := (*s).tokens.CountOneTimeTokenAttempt(tokenHash, auth.PurposePreAuth, (*s).now(), maxPreAuthAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrInvalidPreAuth
+	}
+
+	if recoveryCode != "" {
+		if err := (*s).consumePreAuth(tokenHash); err != nil {
+			return nil, err
+		}
+
+		used, err := (*s).repo.UseRecoveryCode(userID, auth.HashRecoveryCode(recoveryCode))
+		if err != nil {
+			return nil, err
+		}
+		if !used {
+			return nil, ErrInvalidTOTPCode
+		}
+		return user, nil
+	}
+
+	step, ok := auth.VerifyTOTP(user.TOTPSecret, code, (*s).now(), user.TOTPLastStep)
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+	if err := (*s).consumePreAuth(tokenHash); err != nil {
+		return nil, err
+	}
+	if err := (*s).advanceTOTPStep(userID, step); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserService) verifyTOTP(user *domain.User, code string) error {
+	step, ok := auth.VerifyTOTP(user.TOTPSecret, code, (*s).now(), user.TOTPLastStep)
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	return (*s).advanceTOTPStep(user.ID, step)
+}
+
+// advanceTOTPStep records the step of a used code, which guards against the
+// same code being replayed, also between instances.
+func (s *UserService) advanceTOTPStep(userID int, step int64) error {
+	advanced, err := (*s).repo.AdvanceTOTPStep(userID, step)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// consumePreAuth uses up a pre-auth token, it fails when the token expired or
+// was already used in the meantime.
+func (s *UserService) consumePreAuth(tokenHash string) error {
+	consumed, err := (*s).tokens.ConsumeOneTimeToken(tokenHash, auth.PurposePreAuth, (*s).now())
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidPreAuth
+	}
+	return nil
+}
+
+func (s *UserService) regenerateRecoveryCodes(userID int) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashRecoveryCode(code))
+	}
+
+	if err := (*s).repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// -- helpers --
+
+// checkEmail validates and normalizes an address for the user with the id,
+// zero for new users. Empty addresses are allowed.
+func (s *UserService) checkEmail(userID int, email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", nil
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", fmt.Errorf("invalid email address")
+	}
+
+	existing, err := (*s).repo.GetUserByEmail(email)
+	if err == nil && existing.ID != userID {
+		return "", fmt.Errorf("email address already in use")
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	return email, nil
+}
+
+func hashNewPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	return auth.HashPassword(password)
+}
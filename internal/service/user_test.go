@@ -0,0 +1,290 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"blog-system/internal/auth"
+	"blog-system/internal/domain"
+	"blog-system/internal/repository"
+	"blog-system/pkg/database"
+)
+
+// totpStart is the fixed time two-factor is enrolled at, in the past so that
+// the pre-auth tokens signed with the real clock are still valid
+var totpStart = time.Date(2024, 3, 1, 12, 0, 10, 0, time.UTC)
+
+// newTestRepository returns a repository on a fresh database and a session
+// manager to sign tokens with.
+func newTestRepository(t *testing.T) (*repository.SQLiteRepository, *auth.SessionManager) {
+	t.Helper()
+
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "blog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sessionManager := auth.NewSessionManager("test-secret", nil, auth.NewMemoryStore(), auth.SessionTimeouts{
+		Idle:     2 * time.Hour,
+		Absolute: 24 * time.Hour,
+		Remember: 30 * 24 * time.Hour,
+	})
+	return repository.NewSQLiteRepository(db), sessionManager
+}
+
+// newTOTPUser creates a user and enrolls them in two-factor at totpStart. It
+// returns the TOTP secret and the recovery codes.
+func newTOTPUser(t *testing.T, s *UserService) (*domain.User, string, []string) {
+	t.Helper()
+
+	user, err := (*s).CreateUser("alice", "", "correct horse battery", domain.RoleAuthor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	(*s).now = func() time.Time { return totpStart }
+	secret, _, err := (*s).BeginTOTPEnrollment(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := (*s).ConfirmTOTPEnrollment(user.ID, totpCode(t, secret, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, secret, recoveryCodes
+}
+
+// totpCode returns the code for the step offset steps after totpStart.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(totpStart)+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	repo, sessionManager := newTestRepository(t)
+	s := NewUserService(repo, repo, sessionManager, "blog-test")
+	user, secret, recoveryCodes := newTOTPUser(t, s)
+
+	// the steps run in order against the same account, each with a fresh
+	// pre-auth token
+	steps := []struct {
+		name string
+		// the clock, in TOTP steps after the enrollment
+		clock int64
+		// the step the code is generated for, unless recoveryCode is set
+		codeStep     int64
+		recoveryCode string
+		wantErr      error
+	}{
+		{name: "replay of the enrollment code", clock: 0, codeStep: 0, wantErr: ErrInvalidTOTPCode},
+		{name: "one step ahead", clock: 0, codeStep: 1},
+		{name: "replay of the same step", clock: 1, codeStep: 1, wantErr: ErrInvalidTOTPCode},
+		{name: "current step", clock: 2, codeStep: 2},
+		{name: "step before the last used one", clock: 2, codeStep: 1, wantErr: ErrInvalidTOTPCode},
+		{name: "one step behind", clock: 4, codeStep: 3},
+		{name: "two steps behind", clock: 6, codeStep: 4, wantErr: ErrInvalidTOTPCode},
+		{name: "two steps ahead", clock: 6, codeStep: 8, wantErr: ErrInvalidTOTPCode},
+		{name: "recovery code", recoveryCode: recoveryCodes[0]},
+		{name: "same recovery code again", recoveryCode: recoveryCodes[0], wantErr: ErrInvalidTOTPCode},
+		{name: "recovery code in upper case", recoveryCode: "  " + strings.ToUpper(recoveryCodes[1]) + " "},
+		{name: "unknown recovery code", recoveryCode: "aaaaa-bbbbb", wantErr: ErrInvalidTOTPCode},
+	}
+
+	for _, step := range steps {
+		now := totpStart.Add(time.Duration(step.clock) * 30 * time.Second)
+		(*s).now = func() time.Time { return now }
+
+		preAuthToken, _, err := s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		code := ""
+		if step.recoveryCode == "" {
+			code = totpCode(t, secret, step.codeStep)
+		}
+		_, err = s.VerifySecondFactor(user.ID, preAuthToken, code, step.recoveryCode)
+		if !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: error = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+}
+
+func TestVerifySecondFactorPreAuthToken(t *testing.T) {
+	repo, sessionManager := newTestRepository(t)
+	s := NewUserService(repo, repo, sessionManager, "blog-test")
+	user, secret, recoveryCodes := newTOTPUser(t, s)
+	(*s).now = func() time.Time { return totpStart }
+
+	t.Run("attempt limit", func(t *testing.T) {
+		preAuthToken, _, err := s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for attempt := 1; attempt <= maxPreAuthAttempts; attempt++ {
+			if _, err := s.VerifySecondFactor(user.ID, preAuthToken, "000000", ""); !errors.Is(err, ErrInvalidTOTPCode) {
+				t.Fatalf("attempt %d: error = %v, want %v", attempt, err, ErrInvalidTOTPCode)
+			}
+		}
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, totpCode(t, secret, 1), ""); !errors.Is(err, ErrInvalidPreAuth) {
+			t.Errorf("correct code after the limit: error = %v, want %v", err, ErrInvalidPreAuth)
+		}
+	})
+
+	t.Run("single use", func(t *testing.T) {
+		preAuthToken, _, err := s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, totpCode(t, secret, 1), ""); err != nil {
+			t.Fatalf("first use: %v", err)
+		}
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, totpCode(t, secret, -1), ""); !errors.Is(err, ErrInvalidPreAuth) {
+			t.Errorf("second use: error = %v, want %v", err, ErrInvalidPreAuth)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		preAuthToken, expiresAt, err := s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		(*s).now = func() time.Time { return expiresAt.Add(time.Second) }
+		defer func() { (*s).now = func() time.Time { return totpStart } }()
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, "000000", ""); !errors.Is(err, ErrInvalidPreAuth) {
+			t.Errorf("error = %v, want %v", err, ErrInvalidPreAuth)
+		}
+	})
+
+	t.Run("recovery code kept on an invalid token", func(t *testing.T) {
+		used, _, err := s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.VerifySecondFactor(user.ID, used, "", recoveryCodes[2]); err != nil {
+			t.Fatal(err)
+		}
+		expired, expiresAt, err := s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, preAuthToken := range map[string]string{"used": used, "expired": expired} {
+			(*s).now = func() time.Time { return totpStart }
+			if name == "expired" {
+				(*s).now = func() time.Time { return expiresAt.Add(time.Second) }
+			}
+			if _, err := s.VerifySecondFactor(user.ID, preAuthToken, "", recoveryCodes[0]); !errors.Is(err, ErrInvalidPreAuth) {
+				t.Errorf("%s token: error = %v, want %v", name, err, ErrInvalidPreAuth)
+			}
+		}
+		(*s).now = func() time.Time { return totpStart }
+
+		preAuthToken, _, err := s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, "", recoveryCodes[0]); err != nil {
+			t.Errorf("recovery code was spent on an invalid token: %v", err)
+		}
+	})
+
+	t.Run("recovery code kept when the token is used concurrently", func(t *testing.T) {
+		racing := NewUserService(repo, concurrentlyUsedTokens{repo}, sessionManager, "blog-test")
+		(*racing).now = (*s).now
+
+		preAuthToken, _, err := racing.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := racing.VerifySecondFactor(user.ID, preAuthToken, "", recoveryCodes[3]); !errors.Is(err, ErrInvalidPreAuth) {
+			t.Fatalf("error = %v, want %v", err, ErrInvalidPreAuth)
+		}
+
+		preAuthToken, _, err = s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, "", recoveryCodes[3]); err != nil {
+			t.Errorf("recovery code was spent on a token used by another request: %v", err)
+		}
+	})
+
+	t.Run("wrong recovery code", func(t *testing.T) {
+		preAuthToken, _, err := s.StartSecondFactor(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, "", "aaaaa-bbbbb"); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("error = %v, want %v", err, ErrInvalidTOTPCode)
+		}
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, "", recoveryCodes[1]); !errors.Is(err, ErrInvalidPreAuth) {
+			t.Errorf("token still usable after a wrong recovery code: error = %v, want %v", err, ErrInvalidPreAuth)
+		}
+	})
+
+	t.Run("unrecorded token", func(t *testing.T) {
+		preAuthToken, _, err := sessionManager.CreatePreAuthToken(user.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.VerifySecondFactor(user.ID, preAuthToken, "000000", ""); !errors.Is(err, ErrInvalidPreAuth) {
+			t.Errorf("error = %v, want %v", err, ErrInvalidPreAuth)
+		}
+	})
+}
+
+// concurrentlyUsedTokens lets a pre-auth token be used up by another request
+// right after it was checked.
+type concurrentlyUsedTokens struct {
+	repository.OneTimeTokenRepository
+}
+
+func (r concurrentlyUsedTokens) CountOneTimeTokenAttempt(tokenHash, purpose string, now time.Time, maxAttempts int) (bool, error) {
+	allowed, err := r.OneTimeTokenRepository.CountOneTimeTokenAttempt(tokenHash, purpose, now, maxAttempts)
+	if err != nil || !allowed {
+		return allowed, err
+	}
+	_, err = r.OneTimeTokenRepository.ConsumeOneTimeToken(tokenHash, purpose, now)
+	return allowed, err
+}
+
+func TestResetTOTP(t *testing.T) {
+	repo, sessionManager := newTestRepository(t)
+	s := NewUserService(repo, repo, sessionManager, "blog-test")
+	user, _, recoveryCodes := newTOTPUser(t, s)
+
+	if err := s.ResetTOTP(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.TOTPEnabled || user.TOTPSecret != "" {
+		t.Errorf("after reset: enabled = %v, secret = %q, want disabled without a secret", user.TOTPEnabled, user.TOTPSecret)
+	}
+
+	used, err := repo.UseRecoveryCode(user.ID, auth.HashRecoveryCode(recoveryCodes[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used {
+		t.Error("recovery code still usable after reset")
+	}
+}
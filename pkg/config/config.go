@@ -1,18 +1,46 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port          int
-	DBPath        string
-	AdminPassword string
-	SessionSecret string
+	Port                   int
+	DBPath                 string
+	AdminUsername          string
+	AdminPassword          string
+	SessionSecret          string
+	PreviousSessionSecrets []string
+	SessionStore           string
+	LoginAttemptStore      string
+	SessionIdleTimeout     time.Duration
+	SessionAbsoluteTimeout time.Duration
+	SessionRememberTimeout time.Duration
+	TOTPIssuer             string
+	OIDCIssuerURL          string
+	OIDCClientID           string
+	OIDCClientSecret       string
+	OIDCRedirectURL        string
+	OIDCScopes             []string
+	OIDCGroupsClaim        string
+	OIDCGroupRoles         map[string]string
+	OIDCDefaultRole        string
+	OIDCPostLoginRedirect  string
+	BaseURL                string
+	Mailer                 string
+	MailFrom               string
+	SMTPHost               string
+	SMTPPort               int
+	SMTPUsername           string
+	SMTPPassword           string
+	SchedulerInterval      time.Duration
 }
 
 func Load() *Config {
@@ -32,20 +60,164 @@ func Load() *Config {
 		dbPath = "blog.db"
 	}
 
-	adminPassword := os.Getenv("ADMIN_PASSWORD")
-	if adminPassword == "" {
-		log.Fatal("ADMIN_PASSWORD environment variable is required")
+	adminUsername := os.Getenv("ADMIN_USERNAME")
+	if adminUsername == "" {
+		adminUsername = "admin"
 	}
 
+	// only used to create the initial admin account on an empty database
+	adminPassword := os.Getenv("ADMIN_PASSWORD")
+
 	sessionSecret := os.Getenv("SESSION_SECRET")
 	if sessionSecret == "" {
 		log.Fatal("SESSION_SECRET environment variable is required")
 	}
 
+	// retired secrets, cookies signed with them are still accepted
+	var previousSecrets []string
+	for _, secret := range strings.Split(os.Getenv("SESSION_PREVIOUS_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			previousSecrets = append(previousSecrets, secret)
+		}
+	}
+
+	// "sqlite" keeps sessions across restarts, "memory" is mostly useful for development
+	sessionStore := os.Getenv("SESSION_STORE")
+	switch sessionStore {
+	case "":
+		sessionStore = "sqlite"
+	case "sqlite", "memory":
+	default:
+		log.Fatalf("SESSION_STORE must be either \"sqlite\" or \"memory\", got %q", sessionStore)
+	}
+
+	// failed logins are tracked in the same kind of store as sessions unless overridden
+	loginAttemptStore := os.Getenv("LOGIN_ATTEMPT_STORE")
+	switch loginAttemptStore {
+	case "":
+		loginAttemptStore = sessionStore
+	case "sqlite", "memory":
+	default:
+		log.Fatalf("LOGIN_ATTEMPT_STORE must be either \"sqlite\" or \"memory\", got %q", loginAttemptStore)
+	}
+
+	// sessions expire after the idle timeout without activity, and never live
+	// longer than the absolute timeout. "remember me" sessions last for the
+	// remember timeout instead.
+	sessionIdleTimeout := durationEnv("SESSION_IDLE_TIMEOUT", 2*time.Hour)
+	sessionAbsoluteTimeout := durationEnv("SESSION_ABSOLUTE_TIMEOUT", 24*time.Hour)
+	sessionRememberTimeout := durationEnv("SESSION_REMEMBER_TIMEOUT", 30*24*time.Hour)
+	if sessionIdleTimeout > sessionAbsoluteTimeout {
+		log.Fatal("SESSION_IDLE_TIMEOUT cannot be longer than SESSION_ABSOLUTE_TIMEOUT")
+	}
+
+	// name shown next to the account in authenticator apps
+	totpIssuer := os.Getenv("TOTP_ISSUER")
+	if totpIssuer == "" {
+		totpIssuer = "Blog System"
+	}
+
+	// single sign-on is enabled by setting the issuer URL
+	oidcIssuerURL := os.Getenv("OIDC_ISSUER_URL")
+	oidcClientID := os.Getenv("OIDC_CLIENT_ID")
+	oidcRedirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if oidcIssuerURL != "" && (oidcClientID == "" || oidcRedirectURL == "") {
+		log.Fatal("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER_URL is set")
+	}
+
+	// provider groups mapped to roles, as "group=role,other-group=role"
+	oidcGroupRoles := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("OIDC_GROUP_ROLES"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		group, role, found := strings.Cut(pair, "=")
+		if !found {
+			log.Fatalf("OIDC_GROUP_ROLES entries must look like \"group=role\", got %q", pair)
+		}
+		oidcGroupRoles[strings.TrimSpace(group)] = strings.TrimSpace(role)
+	}
+
+	oidcPostLoginRedirect := os.Getenv("OIDC_POST_LOGIN_REDIRECT")
+	if oidcPostLoginRedirect == "" {
+		oidcPostLoginRedirect = "/"
+	}
+
+	// public address of the site, used for links in emails
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://localhost:%d", port)
+	}
+
+	// "capture" does not send emails, which is enough for development
+	mailer := os.Getenv("MAILER")
+	switch mailer {
+	case "":
+		mailer = "capture"
+	case "capture":
+	case "smtp":
+		if os.Getenv("SMTP_HOST") == "" || os.Getenv("MAIL_FROM") == "" {
+			log.Fatal("SMTP_HOST and MAIL_FROM are required when MAILER is \"smtp\"")
+		}
+	default:
+		log.Fatalf("MAILER must be either \"smtp\" or \"capture\", got %q", mailer)
+	}
+
+	smtpPort := 587
+	if portStr := os.Getenv("SMTP_PORT"); portStr != "" {
+		p, err := strconv.Atoi(portStr)
+		if err != nil {
+			log.Fatalf("SMTP_PORT must be a number, got %q", portStr)
+		}
+		smtpPort = p
+	}
+
+	// how often scheduled publishing and unpublishing is checked
+	schedulerInterval := durationEnv("SCHEDULER_INTERVAL", 30*time.Second)
+
 	return &Config{
-		Port:          port,
-		DBPath:        dbPath,
-		AdminPassword: adminPassword,
-		SessionSecret: sessionSecret,
+		Port:                   port,
+		DBPath:                 dbPath,
+		AdminUsername:          adminUsername,
+		AdminPassword:          adminPassword,
+		SessionSecret:          sessionSecret,
+		PreviousSessionSecrets: previousSecrets,
+		SessionStore:           sessionStore,
+		LoginAttemptStore:      loginAttemptStore,
+		SessionIdleTimeout:     sessionIdleTimeout,
+		SessionAbsoluteTimeout: sessionAbsoluteTimeout,
+		SessionRememberTimeout: sessionRememberTimeout,
+		TOTPIssuer:             totpIssuer,
+		OIDCIssuerURL:          oidcIssuerURL,
+		OIDCClientID:           oidcClientID,
+		OIDCClientSecret:       os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:        oidcRedirectURL,
+		OIDCScopes:             strings.Fields(os.Getenv("OIDC_SCOPES")),
+		OIDCGroupsClaim:        os.Getenv("OIDC_GROUPS_CLAIM"),
+		OIDCGroupRoles:         oidcGroupRoles,
+		OIDCDefaultRole:        os.Getenv("OIDC_DEFAULT_ROLE"),
+		OIDCPostLoginRedirect:  oidcPostLoginRedirect,
+		BaseURL:                baseURL,
+		Mailer:                 mailer,
+		MailFrom:               os.Getenv("MAIL_FROM"),
+		SMTPHost:               os.Getenv("SMTP_HOST"),
+		SMTPPort:               smtpPort,
+		SMTPUsername:           os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:           os.Getenv("SMTP_PASSWORD"),
+		SchedulerInterval:      schedulerInterval,
+	}
+}
+
+// -- helpers --
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Fatalf("%s must be a positive duration such as \"30m\" or \"12h\", got %q", key, value)
 	}
+	return d
 }
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// searchTriggers keep articles_fts in step with articles. A server built
+// without FTS5 drops them, since they would make every article write fail,
+// and the next server with FTS5 rebuilds the index.
+var searchTriggers = []struct {
+	name  string
+	query string
+}{
+	{"articles_fts_insert", `CREATE TRIGGER IF NOT EXISTS articles_fts_insert AFTER INSERT ON articles BEGIN
+		INSERT INTO articles_fts (rowid, title, content) VALUES (new.id, new.title, new.content);
+	END`},
+	{"articles_fts_update", `CREATE TRIGGER IF NOT EXISTS articles_fts_update AFTER UPDATE OF title, content ON articles BEGIN
+		UPDATE articles_fts SET title = new.title, content = new.content WHERE rowid = new.id;
+	END`},
+	{"articles_fts_delete", `CREATE TRIGGER IF NOT EXISTS articles_fts_delete AFTER DELETE ON articles BEGIN
+		DELETE FROM articles_fts WHERE rowid = old.id;
+	END`},
+}
+
+// HasFTS5 tells whether the SQLite driver includes FTS5, which the
+// go-sqlite3 driver only does when built with the sqlite_fts5 tag.
+func HasFTS5(db *sql.DB) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled)
+	return enabled, err
+}
+
+// RebuildSearchIndex indexes every article again.
+func RebuildSearchIndex(db *sql.DB) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM articles_fts`); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`INSERT INTO articles_fts (rowid, title, content) SELECT id, title, content FROM articles`)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`INSERT INTO articles_fts (articles_fts) VALUES ('optimize')`); err != nil {
+		return 0, err
+	}
+
+	indexed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(indexed), tx.Commit()
+}
+
+// -- helpers --
+
+// setUpSearch creates the full-text index of articles, or turns it off when
+// the driver has no FTS5.
+func setUpSearch(db *sql.DB) error {
+	enabled, err := HasFTS5(db)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		for _, trigger := range searchTriggers {
+			if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + trigger.name); err != nil {
+				return err
+			}
+		}
+		log.Println("Search is disabled, build with -tags sqlite_fts5 to enable it")
+		return nil
+	}
+
+	// a missing trigger means a new index, or one that missed changes
+	complete := true
+	for _, trigger := range searchTriggers {
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = ?)`, trigger.name).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		complete = complete && exists
+	}
+
+	// diacritics are ignored, "creme" finds "crème"
+	_, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5 (
+		title, content, tokenize = 'unicode61 remove_diacritics 2'
+	)`)
+	if err != nil {
+		return err
+	}
+	for _, trigger := range searchTriggers {
+		if _, err := db.Exec(trigger.query); err != nil {
+			return err
+		}
+	}
+
+	if !complete {
+		indexed, err := RebuildSearchIndex(db)
+		if err != nil {
+			return err
+		}
+		log.Printf("Indexed %d articles for search", indexed)
+	}
+	return nil
+}
@@ -2,12 +2,24 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func NewSQLiteDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// several server instances may share the database file, wait for the
+	// others' writes instead of failing with "database is locked". Taking
+	// the write lock when a transaction begins makes it wait there, rather
+	// than fail when a transaction that has read starts to write. SQLite
+	// only enforces foreign keys, and runs their ON DELETE actions, when
+	// asked to on every connection.
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite3", dbPath+separator+"_busy_timeout=5000&_txlock=immediate&_foreign_keys=on")
 	if err != nil {
 		return nil, err
 	}
@@ -16,6 +28,10 @@ func NewSQLiteDB(dbPath string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -24,8 +40,18 @@ func createTables(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS articles (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			title TEXT NOT NULL,
+			slug TEXT,
 			content TEXT NOT NULL,
+			content_html TEXT NOT NULL DEFAULT '',
+			toc TEXT NOT NULL DEFAULT '[]',
+			render_version INTEGER NOT NULL DEFAULT 0,
 			author TEXT NOT NULL,
+			author_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+			status TEXT NOT NULL DEFAULT 'draft',
+			published_at DATETIME,
+			publish_at DATETIME,
+			unpublish_at DATETIME,
+			scheduled_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -37,6 +63,29 @@ func createTables(db *sql.DB) error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (article_id) REFERENCES articles (id) ON DELETE CASCADE
 		)`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_article_id ON comments (article_id)`,
+		// former slugs of articles, kept to redirect old links
+		`CREATE TABLE IF NOT EXISTS article_slugs (
+			slug TEXT PRIMARY KEY,
+			article_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (article_id) REFERENCES articles (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_article_slugs_article_id ON article_slugs (article_id)`,
+		// tags is a JSON array of tag names
+		`CREATE TABLE IF NOT EXISTS article_revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			article_id INTEGER NOT NULL,
+			revision INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			content TEXT NOT NULL,
+			tags TEXT NOT NULL DEFAULT '[]',
+			author_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+			author_name TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			UNIQUE (article_id, revision),
+			FOREIGN KEY (article_id) REFERENCES articles (id) ON DELETE CASCADE
+		)`,
 		`CREATE TABLE IF NOT EXISTS tags (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name TEXT UNIQUE NOT NULL
@@ -48,6 +97,93 @@ func createTables(db *sql.DB) error {
 			FOREIGN KEY (article_id) REFERENCES articles (id) ON DELETE CASCADE,
 			FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
 		)`,
+		`CREATE INDEX IF NOT EXISTS idx_article_tags_tag_id ON article_tags (tag_id)`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT UNIQUE NOT NULL COLLATE NOCASE,
+			password_hash TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT 'author',
+			disabled BOOLEAN NOT NULL DEFAULT 0,
+			totp_secret TEXT NOT NULL DEFAULT '',
+			totp_enabled BOOLEAN NOT NULL DEFAULT 0,
+			totp_last_step INTEGER NOT NULL DEFAULT 0,
+			email TEXT COLLATE NOCASE,
+			oidc_subject TEXT,
+			sso_managed BOOLEAN NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			absolute_expires_at DATETIME,
+			remember BOOLEAN NOT NULL DEFAULT 0,
+			last_seen_at DATETIME,
+			ip TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at)`,
+		`CREATE TABLE IF NOT EXISTS recovery_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			code_hash TEXT NOT NULL,
+			used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id)`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			scopes TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			last_used_at DATETIME,
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id)`,
+		`CREATE TABLE IF NOT EXISTS login_attempts (
+			key TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL DEFAULT 0,
+			locked_until DATETIME,
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS one_time_tokens (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			purpose TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_one_time_tokens_user_id ON one_time_tokens (user_id, purpose)`,
+		// no foreign key on actor_id, events outlive the users they mention
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor_id INTEGER,
+			actor_name TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL DEFAULT '',
+			target_id TEXT NOT NULL DEFAULT '',
+			before TEXT NOT NULL DEFAULT '',
+			after TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id)`,
+		// the audit log is append-only
+		`CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+			BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+			BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END`,
 	}
 
 	for _, query := range queries {
@@ -57,3 +193,158 @@ func createTables(db *sql.DB) error {
 	}
 	return nil
 }
+
+// migrate brings databases created by older versions up to the current schema.
+func migrate(db *sql.DB) error {
+	// articles used to be public as soon as they were created
+	hasStatus, err := hasColumn(db, "articles", "status")
+	if err != nil {
+		return err
+	}
+	if !hasStatus {
+		queries := []string{
+			`ALTER TABLE articles ADD COLUMN status TEXT NOT NULL DEFAULT 'published'`,
+			`ALTER TABLE articles ADD COLUMN published_at DATETIME`,
+			`UPDATE articles SET published_at = created_at`,
+		}
+		for _, query := range queries {
+			if _, err := db.Exec(query); err != nil {
+				return err
+			}
+		}
+	}
+
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"articles", "author_id", "INTEGER REFERENCES users (id) ON DELETE SET NULL"},
+		{"articles", "slug", "TEXT"},
+		{"articles", "content_html", "TEXT NOT NULL DEFAULT ''"},
+		{"articles", "toc", "TEXT NOT NULL DEFAULT '[]'"},
+		{"articles", "render_version", "INTEGER NOT NULL DEFAULT 0"},
+		{"articles", "publish_at", "DATETIME"},
+		{"articles", "unpublish_at", "DATETIME"},
+		{"articles", "scheduled_by", "INTEGER REFERENCES users (id) ON DELETE SET NULL"},
+		{"sessions", "last_seen_at", "DATETIME"},
+		{"sessions", "ip", "TEXT NOT NULL DEFAULT ''"},
+		{"sessions", "user_agent", "TEXT NOT NULL DEFAULT ''"},
+		{"sessions", "absolute_expires_at", "DATETIME"},
+		{"sessions", "remember", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "email", "TEXT COLLATE NOCASE"},
+		{"users", "oidc_subject", "TEXT"},
+		{"users", "sso_managed", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"one_time_tokens", "attempts", "INTEGER NOT NULL DEFAULT 0"},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// article dates set from Go used to be stored with fractional seconds
+	// and "+00:00", which does not compare as text with the
+	// CURRENT_TIMESTAMP format of created_at and updated_at
+	for _, column := range []string{"published_at", "publish_at", "unpublish_at"} {
+		query := fmt.Sprintf(`UPDATE articles SET %[1]s = datetime(%[1]s) WHERE %[1]s != datetime(%[1]s)`, column)
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	// indexes on columns added above, they cannot be part of createTables
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_articles_status ON articles (status, published_at)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_articles_slug ON articles (slug)`,
+		`CREATE INDEX IF NOT EXISTS idx_articles_publish_at ON articles (publish_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_articles_unpublish_at ON articles (unpublish_at)`,
+		// the orders articles are listed in
+		`CREATE INDEX IF NOT EXISTS idx_articles_created_at ON articles (created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_articles_updated_at ON articles (updated_at, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_articles_published ON articles (COALESCE(published_at, created_at), id)`,
+		`CREATE INDEX IF NOT EXISTS idx_articles_title ON articles (LOWER(title), id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users (oidc_subject)`,
+	}
+	for _, query := range indexes {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	// rows left behind by deletes made while foreign keys were not enforced
+	orphans := []string{
+		`DELETE FROM comments WHERE article_id NOT IN (SELECT id FROM articles)`,
+		`DELETE FROM article_slugs WHERE article_id NOT IN (SELECT id FROM articles)`,
+		`DELETE FROM article_revisions WHERE article_id NOT IN (SELECT id FROM articles)`,
+		`DELETE FROM article_tags WHERE article_id NOT IN (SELECT id FROM articles) OR tag_id NOT IN (SELECT id FROM tags)`,
+		`UPDATE articles SET author_id = NULL WHERE author_id NOT IN (SELECT id FROM users)`,
+		`UPDATE articles SET scheduled_by = NULL WHERE scheduled_by NOT IN (SELECT id FROM users)`,
+		`UPDATE article_revisions SET author_id = NULL WHERE author_id NOT IN (SELECT id FROM users)`,
+		`DELETE FROM sessions WHERE user_id NOT IN (SELECT id FROM users)`,
+		`DELETE FROM recovery_codes WHERE user_id NOT IN (SELECT id FROM users)`,
+		`DELETE FROM api_tokens WHERE user_id NOT IN (SELECT id FROM users)`,
+		`DELETE FROM one_time_tokens WHERE user_id NOT IN (SELECT id FROM users)`,
+	}
+	for _, query := range orphans {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	// articles written before revisions were kept start with their current state
+	_, err = db.Exec(`INSERT INTO article_revisions (article_id, revision, title, content, tags, author_id, author_name, created_at)
+		SELECT a.id, 1, a.title, a.content,
+			(SELECT json_group_array(t.name) FROM article_tags at JOIN tags t ON t.id = at.tag_id WHERE at.article_id = a.id),
+			a.author_id, a.author, a.updated_at
+		FROM articles a
+		WHERE NOT EXISTS (SELECT 1 FROM article_revisions r WHERE r.article_id = a.id)`)
+	if err != nil {
+		return err
+	}
+
+	return setUpSearch(db)
+}
+
+// -- helpers --
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,259 @@
+// Package diff compares texts line by line and formats the result as a
+// unified diff, like "diff -u".
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around changes.
+const DefaultContext = 3
+
+// The time taken grows with the number of lines times the number of changed
+// lines, so texts beyond these limits are not compared.
+const (
+	MaxLines = 20000
+	MaxEdits = 2000
+)
+
+// ErrTooLarge is returned for texts too long or too different to compare.
+var ErrTooLarge = errors.New("texts too large to compare")
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+// op is one line of the edit script, a and b are the positions in the old
+// and new text when it applies.
+type op struct {
+	kind opKind
+	a, b int
+	line string
+}
+
+// Unified returns the unified diff turning from into to, or "" when they are
+// equal. fromName and toName are used in the "---" and "+++" headers.
+func Unified(fromName, toName, from, to string, context int) (string, error) {
+	ops, err := lineOps(splitLines(from), splitLines(to))
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, hunk := range hunks(ops, context) {
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, ops[hunk[0]:hunk[1]])
+	}
+	return out.String(), nil
+}
+
+// -- helpers --
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// lineOps finds a shortest edit script with the linear space variant of
+// Myers' algorithm, which splits the texts at the middle of a shortest path
+// and recurses on both halves.
+func lineOps(a, b []string) ([]op, error) {
+	if len(a) > MaxLines || len(b) > MaxLines {
+		return nil, fmt.Errorf("%w: more than %d lines", ErrTooLarge, MaxLines)
+	}
+
+	d := &differ{a: a, b: b}
+	if err := d.compare(0, len(a), 0, len(b)); err != nil {
+		return nil, err
+	}
+	return (*d).ops, nil
+}
+
+// differ collects the edit script of a and b in order.
+type differ struct {
+	a, b []string
+	ops  []op
+}
+
+// compare appends the edit script turning a[a0:a1] into b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) error {
+	a, b := (*d).a, (*d).b
+
+	// common lines at either end are not worth searching
+	for a0 < a1 && b0 < b1 && a[a0] == b[b0] {
+		(*d).ops = append((*d).ops, op{kind: opEqual, a: a0, b: b0, line: a[a0]})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && a[a1-suffix-1] == b[b1-suffix-1] {
+		suffix++
+	}
+	a1 -= suffix
+	b1 -= suffix
+
+	switch {
+	case a0 == a1:
+		for y := b0; y < b1; y++ {
+			(*d).ops = append((*d).ops, op{kind: opInsert, a: a0, b: y, line: b[y]})
+		}
+	case b0 == b1:
+		for x := a0; x < a1; x++ {
+			(*d).ops = append((*d).ops, op{kind: opDelete, a: x, b: b0, line: a[x]})
+		}
+	default:
+		// with the ends trimmed the distance is at least 2, so both
+		// halves are smaller than the whole
+		x, y, u, v, err := d.middleSnake(a0, a1, b0, b1)
+		if err != nil {
+			return err
+		}
+		if err := d.compare(a0, x, b0, y); err != nil {
+			return err
+		}
+		for ; x < u; x, y = x+1, y+1 {
+			(*d).ops = append((*d).ops, op{kind: opEqual, a: x, b: y, line: a[x]})
+		}
+		if err := d.compare(u, a1, v, b1); err != nil {
+			return err
+		}
+	}
+
+	for i := range suffix {
+		(*d).ops = append((*d).ops, op{kind: opEqual, a: a1 + i, b: b1 + i, line: a[a1+i]})
+	}
+	return nil
+}
+
+// middleSnake searches a shortest path through a[a0:a1] and b[b0:b1] from
+// both ends at once, and returns the diagonal run from (x, y) to (u, v)
+// where the searches meet. It gives up with ErrTooLarge once the path would
+// need more than MaxEdits inserted or deleted lines.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int, err error) {
+	a, b := (*d).a, (*d).b
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+
+	// forward[k] and backward[k] are the furthest x reached on diagonal
+	// x-y = k from the start and from the end
+	rounds := min((n+m+1)/2, MaxEdits/2+1)
+	offset := rounds + 1
+	forward := make([]int, 2*rounds+3)
+	backward := make([]int, 2*rounds+3)
+
+	for r := 0; r <= rounds; r++ {
+		for k := -r; k <= r; k += 2 {
+			var x int
+			if k == -r || (k != r && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[a0+x] == b[b0+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			// the backward search is on diagonal delta-k, one round behind
+			if odd && k >= delta-(r-1) && k <= delta+(r-1) && x+backward[offset+delta-k] >= n {
+				return a0 + startX, b0 + startY, a0 + x, b0 + y, checkEdits(2*r - 1)
+			}
+		}
+
+		for k := -r; k <= r; k += 2 {
+			var x int
+			if k == -r || (k != r && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[a1-1-x] == b[b1-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			if !odd && delta-k >= -r && delta-k <= r && x+forward[offset+delta-k] >= n {
+				return a1 - x, b1 - y, a1 - startX, b1 - startY, checkEdits(2 * r)
+			}
+		}
+	}
+
+	return 0, 0, 0, 0, checkEdits(MaxEdits + 1)
+}
+
+func checkEdits(edits int) error {
+	if edits > MaxEdits {
+		return fmt.Errorf("%w: more than %d lines changed", ErrTooLarge, MaxEdits)
+	}
+	return nil
+}
+
+// hunks returns [start, end) ranges of ops covering every change with up to
+// context unchanged lines around it. Changes closer than twice the context
+// share a hunk.
+func hunks(ops []op, context int) [][2]int {
+	var ranges [][2]int
+	for i, o := range ops {
+		if o.kind == opEqual {
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i + 1 + context
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		if last := len(ranges) - 1; last >= 0 && start <= ranges[last][1] {
+			ranges[last][1] = end
+			continue
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges
+}
+
+func writeHunk(out *strings.Builder, ops []op) {
+	var fromCount, toCount int
+	for _, o := range ops {
+		if o.kind != opInsert {
+			fromCount++
+		}
+		if o.kind != opDelete {
+			toCount++
+		}
+	}
+
+	// empty ranges start at the line before them
+	fromStart, toStart := ops[0].a, ops[0].b
+	if fromCount > 0 {
+		fromStart++
+	}
+	if toCount > 0 {
+		toStart++
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", fromStart, fromCount, toStart, toCount)
+	for _, o := range ops {
+		fmt.Fprintf(out, "%c%s\n", o.kind, o.line)
+	}
+}
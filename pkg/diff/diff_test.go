@@ -0,0 +1,205 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{name: "equal", from: "a\nb\n", to: "a\nb\n", want: ""},
+		{name: "both empty", from: "", to: "", want: ""},
+		{
+			name: "from empty",
+			from: "",
+			to:   "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "to empty",
+			from: "a\n",
+			to:   "",
+			want: "--- old\n+++ new\n@@ -1,1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "changed line",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate hunks",
+			from: "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			to:   "A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Unified("old", "new", tt.from, tt.to, DefaultContext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("diff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLineOpsShortest compares the edit scripts of random texts with the
+// edit distance found by dynamic programming.
+func TestLineOpsShortest(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		text := make([]string, random.Intn(30))
+		for i := range text {
+			text[i] = string(rune('a' + random.Intn(4)))
+		}
+		return text
+	}
+
+	for range 1000 {
+		a, b := lines(), lines()
+		ops, err := lineOps(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if edits := checkOps(t, a, b, ops); edits != editDistance(a, b) {
+			t.Fatalf("%v to %v: %d edits, want %d", a, b, edits, editDistance(a, b))
+		}
+	}
+}
+
+func TestLineOpsLarge(t *testing.T) {
+	a := make([]string, MaxLines)
+	for i := range a {
+		a[i] = fmt.Sprintf("line %d", i)
+	}
+
+	// a few changes spread over the whole text
+	b := append([]string(nil), a...)
+	for i := 0; i < len(b); i += len(b) / MaxEdits * 4 {
+		b[i] = "changed"
+	}
+
+	start := time.Now()
+	ops, err := lineOps(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edits := checkOps(t, a, b, ops); edits != MaxEdits/2 {
+		t.Errorf("%d edits, want %d", edits, MaxEdits/2)
+	}
+	t.Logf("compared %d lines with %d edits in %v", len(a), MaxEdits/2, time.Since(start))
+
+	tooLong := append(a, "one more")
+	replaced := make([]string, MaxLines)
+	for i := range replaced {
+		replaced[i] = "replaced"
+	}
+
+	tests := []struct {
+		name string
+		a, b []string
+	}{
+		{name: "too many lines", a: a, b: tooLong},
+		{name: "too many changes", a: a, b: replaced},
+		{name: "just too many changes", a: a[:MaxEdits/2+1], b: replaced[:MaxEdits/2]},
+	}
+	for _, tt := range tests {
+		if _, err := lineOps(tt.a, tt.b); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, ErrTooLarge)
+		}
+	}
+
+	// right at the limit still works
+	if _, err := lineOps(a[:MaxEdits/2], replaced[:MaxEdits/2]); err != nil {
+		t.Errorf("%d changes: %v", MaxEdits, err)
+	}
+}
+
+// checkOps checks that ops turn a into b and returns how many lines they
+// insert or delete.
+func checkOps(t *testing.T, a, b []string, ops []op) int {
+	t.Helper()
+
+	var x, y, edits int
+	for _, o := range ops {
+		if o.a != x || o.b != y {
+			t.Fatalf("op %c%s at %d,%d, want %d,%d", o.kind, o.line, o.a, o.b, x, y)
+		}
+		switch o.kind {
+		case opEqual:
+			if a[x] != o.line || b[y] != o.line {
+				t.Fatalf("equal %q at %d,%d is %q and %q", o.line, x, y, a[x], b[y])
+			}
+			x++
+			y++
+		case opDelete:
+			if a[x] != o.line {
+				t.Fatalf("delete %q at %d is %q", o.line, x, a[x])
+			}
+			x++
+			edits++
+		case opInsert:
+			if b[y] != o.line {
+				t.Fatalf("insert %q at %d is %q", o.line, y, b[y])
+			}
+			y++
+			edits++
+		}
+	}
+	if x != len(a) || y != len(b) {
+		t.Fatalf("ops end at %d,%d, want %d,%d", x, y, len(a), len(b))
+	}
+	return edits
+}
+
+// editDistance counts the lines inserted and deleted by a shortest edit
+// script, from the longest common subsequence.
+func editDistance(a, b []string) int {
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+	return len(a) + len(b) - 2*common[0][0]
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a\n", []string{"a"}},
+		{"a\n\nb", []string{"a", "", "b"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitLines(tt.text); strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("splitLines(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
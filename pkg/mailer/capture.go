@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"log"
+	"sync"
+)
+
+// CaptureMailer keeps messages in memory instead of sending them, for local
+// development and tests. Only the recipient and subject are logged, bodies
+// carry login and reset tokens which must not end up in logs.
+type CaptureMailer struct {
+	messages []Message
+	mutex    sync.Mutex
+	quiet    bool
+}
+
+func NewCaptureMailer() *CaptureMailer {
+	return &CaptureMailer{}
+}
+
+// NewQuietCaptureMailer returns a CaptureMailer that does not log messages.
+func NewQuietCaptureMailer() *CaptureMailer {
+	return &CaptureMailer{quiet: true}
+}
+
+func (m *CaptureMailer) Send(message Message) error {
+	(*m).mutex.Lock()
+	(*m).messages = append((*m).messages, message)
+	(*m).mutex.Unlock()
+
+	if !(*m).quiet {
+		log.Printf("Captured mail to %s: %s", message.To, message.Subject)
+	}
+	return nil
+}
+
+func (m *CaptureMailer) Messages() []Message {
+	(*m).mutex.Lock()
+	defer (*m).mutex.Unlock()
+
+	return append([]Message(nil), (*m).messages...)
+}
+
+// Last returns the most recent message sent to the address.
+func (m *CaptureMailer) Last(to string) (Message, bool) {
+	(*m).mutex.Lock()
+	defer (*m).mutex.Unlock()
+
+	for i := len((*m).messages) - 1; i >= 0; i-- {
+		if (*m).messages[i].To == to {
+			return (*m).messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+func (m *CaptureMailer) Reset() {
+	(*m).mutex.Lock()
+	(*m).messages = nil
+	(*m).mutex.Unlock()
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestCaptureMailerKeepsBodiesOutOfTheLog(t *testing.T) {
+	var logged bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&logged)
+	defer log.SetOutput(output)
+
+	m := NewCaptureMailer()
+	message := Message{To: "alice@example.com", Subject: "Your login link", Body: "http://blog.test/magic-link?token=secret-token"}
+	if err := m.Send(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(logged.String(), "secret-token") {
+		t.Errorf("the body was logged: %s", logged.String())
+	}
+	if !strings.Contains(logged.String(), "alice@example.com") || !strings.Contains(logged.String(), "Your login link") {
+		t.Errorf("recipient and subject were not logged: %s", logged.String())
+	}
+
+	if got, ok := m.Last("alice@example.com"); !ok || got.Body != message.Body {
+		t.Errorf("Last = %+v, %v, want the captured message", got, ok)
+	}
+}
@@ -0,0 +1,181 @@
+// Package markdown renders article Markdown to sanitized HTML.
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"blog-system/pkg/slug"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Version changes whenever the same Markdown would render differently, so
+// HTML cached by an older version can be rendered again.
+const Version = 2
+
+// HighlightStyle is the chroma style used for code blocks.
+const HighlightStyle = "github"
+
+// Rendered is the result of Render.
+type Rendered struct {
+	HTML string
+	// TOC lists the top level headings, with the ones below them nested
+	TOC []*Heading
+}
+
+// Heading is an entry of a table of contents. Anchor is the id of the
+// heading in the HTML.
+type Heading struct {
+	Level    int
+	Text     string
+	Anchor   string
+	Children []*Heading
+}
+
+var (
+	converter = goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM, // tables, task lists, strikethrough, autolinks
+			extension.Footnote,
+			// fenced code blocks with a known language, styled inline
+			highlighting.NewHighlighting(highlighting.WithStyle(HighlightStyle)),
+		),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+		// raw HTML is let through here and cleaned up by the policy
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+
+	policy = newPolicy()
+)
+
+// Render converts CommonMark with GitHub extensions and footnotes to HTML
+// that is safe to embed in a page. Headings get anchors made from their text,
+// which stay the same as long as the headings do.
+func Render(source string) (*Rendered, error) {
+	src := []byte(source)
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{used: make(map[string]bool)}))
+	doc := converter.Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+
+	var out bytes.Buffer
+	if err := converter.Renderer().Render(&out, src, doc); err != nil {
+		return nil, err
+	}
+
+	return &Rendered{
+		HTML: policy.Sanitize(out.String()),
+		TOC:  tableOfContents(doc, src),
+	}, nil
+}
+
+// -- helpers --
+
+// newPolicy allows what user generated content usually needs, plus the
+// markup of the Markdown extensions and the highlighter.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// task lists
+	p.AllowElements("input")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	// fenced code languages and footnotes
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnotes?(-ref|-backref|-list)?$`)).OnElements("a", "div", "ol", "sup", "section")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-[a-z]+$`)).OnElements("a", "div", "section")
+
+	// highlighted code
+	p.AllowStyles("color", "background-color", "font-weight", "font-style", "text-decoration").OnElements("pre", "span")
+	p.AllowStyles("display").MatchingEnum("flex").OnElements("span")
+
+	return p
+}
+
+// headingIDs makes heading anchors with the same rules as article slugs,
+// adding "-2", "-3"... to repeated ones.
+type headingIDs struct {
+	used map[string]bool
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	base := slug.Make(string(value))
+	if base == "" {
+		base = "section"
+	}
+
+	for n := 1; ; n++ {
+		candidate := slug.WithSuffix(base, n)
+		if !(*ids).used[candidate] {
+			(*ids).used[candidate] = true
+			return []byte(candidate)
+		}
+	}
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	(*ids).used[string(value)] = true
+}
+
+func tableOfContents(doc ast.Node, src []byte) []*Heading {
+	toc := []*Heading{}
+	var open []*Heading // the current heading of every level above
+
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		entry := &Heading{Level: heading.Level, Text: plainText(heading, src)}
+		if id, ok := heading.AttributeString("id"); ok {
+			if anchor, ok := id.([]byte); ok {
+				entry.Anchor = string(anchor)
+			}
+		}
+
+		for len(open) > 0 && open[len(open)-1].Level >= entry.Level {
+			open = open[:len(open)-1]
+		}
+		if len(open) == 0 {
+			toc = append(toc, entry)
+		} else {
+			parent := open[len(open)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+		open = append(open, entry)
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	return toc
+}
+
+// plainText returns the text of node without any markup.
+func plainText(node ast.Node, src []byte) string {
+	var b strings.Builder
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := n.(type) {
+		case *ast.Text:
+			b.Write(t.Value(src))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(t.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,160 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderSanitizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		removed []string
+	}{
+		{name: "script", source: "<script>alert(1)</script>\n\nText", removed: []string{"<script", "alert"}},
+		{name: "inline script", source: "Text <script>alert(1)</script>", removed: []string{"<script", "alert"}},
+		{name: "javascript link", source: "[click](javascript:alert(1))", removed: []string{"href", "javascript:"}},
+		{name: "mixed case javascript link", source: "[click](JaVaScRiPt:alert(1))", removed: []string{"href", "alert"}},
+		{name: "javascript html link", source: `<a href="javascript:alert(1)">click</a>`, removed: []string{"href", "javascript:"}},
+		{name: "data link", source: `<a href="data:text/html;base64,PHNjcmlwdD4=">click</a>`, removed: []string{"href", "data:"}},
+		{name: "event handler", source: `<img src="x.png" onerror="alert(1)">`, removed: []string{"onerror", "alert"}},
+		{name: "event handler on text", source: `<p onclick="alert(1)" onmouseover="alert(2)">Text</p>`, removed: []string{"onclick", "onmouseover"}},
+		{name: "iframe", source: `<iframe src="https://example.com"></iframe>`, removed: []string{"<iframe"}},
+		{name: "style", source: "<style>body { display: none }</style>", removed: []string{"<style", "display"}},
+		{name: "inline style", source: `<div style="position: fixed">Text</div>`, removed: []string{"style", "position"}},
+		{name: "form", source: `<form action="/api/auth/logout"><button>Go</button></form>`, removed: []string{"<form", "action"}},
+		{name: "text input", source: `<input type="text" value="x">`, removed: []string{`type="text"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, removed := range tt.removed {
+				if strings.Contains(strings.ToLower(rendered.HTML), strings.ToLower(removed)) {
+					t.Errorf("%q is kept in %s", removed, rendered.HTML)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderKeepsMarkup(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		kept   []string
+	}{
+		{
+			name:   "heading ids",
+			source: "# Intro\n\n## Intro\n\n## Café *crème*\n\n## !!!",
+			kept:   []string{`<h1 id="intro">`, `<h2 id="intro-2">`, `<h2 id="cafe-creme">`, `<h2 id="section">`},
+		},
+		{
+			name:   "footnotes",
+			source: "Text[^note]\n\n[^note]: The note.",
+			kept: []string{
+				`<sup id="fnref:1"><a href="#fn:1" class="footnote-ref" role="doc-noteref"`,
+				`<div class="footnotes" role="doc-endnotes">`,
+				`<li id="fn:1">`,
+				`<a href="#fnref:1" class="footnote-backref" role="doc-backlink"`,
+			},
+		},
+		{
+			name:   "links",
+			source: "[site](https://example.com) and <https://example.org>",
+			kept:   []string{`href="https://example.com"`, `href="https://example.org"`},
+		},
+		{
+			name:   "task list",
+			source: "- [x] done\n- [ ] todo",
+			kept:   []string{`<input checked="" disabled="" type="checkbox">`, `<input disabled="" type="checkbox">`},
+		},
+		{
+			name:   "table",
+			source: "| a | b |\n|---|---|\n| 1 | 2 |",
+			kept:   []string{"<table>", "<th>a</th>", "<td>2</td>"},
+		},
+		{
+			name:   "highlighted code",
+			source: "```go\nfunc main() {}\n```",
+			kept:   []string{`<pre style="background-color: #f7f7f7">`, `<span style="color: #cf222e">func</span>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, kept := range tt.kept {
+				if !strings.Contains(rendered.HTML, kept) {
+					t.Errorf("%s is missing from %s", kept, rendered.HTML)
+				}
+			}
+		})
+	}
+}
+
+func TestTableOfContents(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{name: "no headings", source: "Just text.", want: ""},
+		{
+			name:   "nested",
+			source: "# Intro\n\n## Setup\n\n### Linux\n\n### macOS\n\n## Usage\n\n# Reference",
+			want:   "intro(Intro setup(Setup linux(Linux) macos(macOS)) usage(Usage)) reference(Reference)",
+		},
+		{
+			name:   "skipped level",
+			source: "# Top\n\n### Deep\n\n## Middle",
+			want:   "top(Top deep(Deep) middle(Middle))",
+		},
+		{
+			name:   "starting below the top level",
+			source: "## First\n\n### Inner\n\n# Title\n\n## Second",
+			want:   "first(First inner(Inner)) title(Title second(Second))",
+		},
+		{
+			name:   "markup and repeated text",
+			source: "# Using `go test` with *flags*\n\n# Notes\n\n# Notes\n\nSetext\n======",
+			want:   "using-go-test-with-flags(Using go test with flags) notes(Notes) notes-2(Notes) setext(Setext)",
+		},
+		{
+			name:   "code blocks are not headings",
+			source: "> # Quoted\n\n```\n# Code\n```\n\n# Real",
+			want:   "quoted(Quoted) real(Real)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatTOC(rendered.TOC); got != tt.want {
+				t.Errorf("TOC = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// formatTOC writes headings as anchor(text children...).
+func formatTOC(headings []*Heading) string {
+	var entries []string
+	for _, heading := range headings {
+		entry := heading.Anchor + "(" + heading.Text
+		if children := formatTOC(heading.Children); children != "" {
+			entry += " " + children
+		}
+		entries = append(entries, entry+")")
+	}
+	return strings.Join(entries, " ")
+}
@@ -0,0 +1,53 @@
+// Package slug turns titles into URL friendly identifiers such as
+// "hello-world".
+package slug
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gosimple/unidecode"
+)
+
+// MaxLength is the longest slug Make returns, before any suffix.
+const MaxLength = 80
+
+// Make transliterates text to ASCII ("Crème Brûlée" becomes "creme-brulee",
+// "Привет" becomes "privet") and keeps lowercase letters and digits, joined
+// by single hyphens. It returns "" when nothing is left.
+func Make(text string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(unidecode.Unidecode(text)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+		default:
+			hyphen = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > MaxLength {
+		slug = slug[:MaxLength]
+		// don't cut a word in half when there is an earlier break
+		if cut := strings.LastIndexByte(slug, '-'); cut > MaxLength/2 {
+			slug = slug[:cut]
+		}
+		slug = strings.TrimSuffix(slug, "-")
+	}
+	return slug
+}
+
+// WithSuffix returns the n-th candidate for a taken slug: the slug itself
+// for n <= 1, then "slug-2", "slug-3" and so on.
+func WithSuffix(slug string, n int) string {
+	if n <= 1 {
+		return slug
+	}
+	return slug + "-" + strconv.Itoa(n)
+}
@@ -0,0 +1,56 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello World", "hello-world"},
+		{"  --Hello,   World!-- ", "hello-world"},
+		{"Go 1.22 released", "go-1-22-released"},
+		{"C++ & Go", "c-go"},
+		{"Crème Brûlée", "creme-brulee"},
+		{"Straße", "strasse"},
+		{"Ærøskøbing", "aeroskobing"},
+		{"Привет, мир!", "privet-mir"},
+		{"東京", "dong-jing"},
+		{"", ""},
+		{"!!!", ""},
+		{"🎉", ""},
+		// cut at the last word break before MaxLength
+		{long, strings.TrimSuffix(strings.Repeat("word-", 16), "-")},
+		// or in the middle of a word when there is no break late enough
+		{strings.Repeat("x", 100), strings.Repeat("x", MaxLength)},
+	}
+
+	for _, tt := range tests {
+		if got := Make(tt.text); got != tt.want {
+			t.Errorf("Make(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWithSuffix(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "hello"},
+		{1, "hello"},
+		{2, "hello-2"},
+		{10, "hello-10"},
+	}
+
+	for _, tt := range tests {
+		if got := WithSuffix("hello", tt.n); got != tt.want {
+			t.Errorf("WithSuffix(hello, %d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}